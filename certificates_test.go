@@ -0,0 +1,159 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testIssuer is a certificate with its private key, which issues further certificates in tests.
+type testIssuer struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	return key
+}
+
+// issueTestCertificate creates a certificate for the key from the template, signed by the issuer or self-signed if
+// the issuer is nil.
+func issueTestCertificate(
+	t *testing.T,
+	template *x509.Certificate,
+	key crypto.Signer,
+	issuer *testIssuer,
+) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	assert.Nil(t, err)
+	template.SerialNumber = serial
+	parent, parentKey := template, key
+	if issuer != nil {
+		parent, parentKey = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
+
+// newTestCA creates a CA certificate valid between notBefore and notAfter, signed by the parent or self-signed if the
+// parent is nil.
+func newTestCA(t *testing.T, commonName string, parent *testIssuer, notBefore, notAfter time.Time) *testIssuer {
+	key := newTestKey(t)
+	cert := issueTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, key, parent)
+	return &testIssuer{cert: cert, key: key}
+}
+
+// newTestIssuer creates a CA certificate valid for the next day, signed by the parent or self-signed if the parent is
+// nil.
+func newTestIssuer(t *testing.T, commonName string, parent *testIssuer) *testIssuer {
+	return newTestCA(t, commonName, parent, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+}
+
+// newTestClientCertificate creates a client certificate for the key valid between notBefore and notAfter, signed by
+// the issuer or self-signed if the issuer is nil.
+func newTestClientCertificate(
+	t *testing.T,
+	commonName string,
+	key crypto.Signer,
+	issuer *testIssuer,
+	notBefore time.Time,
+	notAfter time.Time,
+) *x509.Certificate {
+	return issueTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, key, issuer)
+}
+
+func certificatePEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+func privateKeyPEM(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// newTestKeyPair creates a self-signed client certificate with the given common name and returns the certificate and
+// the key in PEM format.
+func newTestKeyPair(t *testing.T, commonName string) ([]byte, []byte) {
+	key := newTestKey(t)
+	cert := newTestClientCertificate(t, commonName, key, nil, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	return []byte(certificatePEM(cert)), []byte(privateKeyPEM(t, key))
+}
+
+func writeTestKeyPair(t *testing.T, dir string, commonName string) (string, string) {
+	certData, keyData := newTestKeyPair(t, commonName)
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	assert.Nil(t, os.WriteFile(certFile, certData, 0600))
+	assert.Nil(t, os.WriteFile(keyFile, keyData, 0600))
+	return certFile, keyFile
+}
+
+// newTestTLSServer starts a TLS server presenting a server certificate for 127.0.0.1 and kubernetes.local issued by
+// the issuer, followed by the additional chain certificates.
+func newTestTLSServer(
+	t *testing.T,
+	issuer *testIssuer,
+	notAfter time.Time,
+	chain ...*x509.Certificate,
+) *httptest.Server {
+	return newTestTLSServerWithHandler(t, http.NotFoundHandler(), issuer, notAfter, chain...)
+}
+
+func newTestTLSServerWithHandler(
+	t *testing.T,
+	handler http.Handler,
+	issuer *testIssuer,
+	notAfter time.Time,
+	chain ...*x509.Certificate,
+) *httptest.Server {
+	key := newTestKey(t)
+	cert := issueTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "kube-apiserver"},
+		NotBefore:   time.Now().Add(-2 * time.Hour),
+		NotAfter:    notAfter,
+		DNSNames:    []string{"kubernetes.local"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, key, issuer)
+	certificate := tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+	for _, chainCert := range chain {
+		certificate.Certificate = append(certificate.Certificate, chainCert.Raw)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
@@ -0,0 +1,254 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"weak"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// ClientOptions holds the options for ClientWithOptions and RESTClientWithOptions.
+type ClientOptions struct {
+	// Timeout overrides the request timeout of the connection. A zero timeout disables the timeout, for example for
+	// clients that watch resources or stream logs.
+	Timeout *time.Duration
+	// QPS overrides the maximum sustained queries per second of the connection.
+	QPS *float32
+	// Burst overrides the maximum burst of queries of the connection.
+	Burst *int
+	// UserAgent overrides the user agent of the connection.
+	UserAgent string
+	// OnCertificateRotation is called when the client certificate and key files changed. On success, the leaf
+	// certificate now in use is passed. If the new files cannot be loaded, for example because only the certificate
+	// was replaced so far, the error is passed and the previous certificate remains in use. An error is only passed
+	// again once it changed or the files were loaded successfully in between.
+	OnCertificateRotation func(cert *x509.Certificate, err error)
+}
+
+// clientCertificateCheckInterval is the minimum time between two checks of the client certificate files for changes.
+var clientCertificateCheckInterval = time.Minute
+
+// ClientCertificateSource serves a client certificate loaded from a certificate and a key file. When a TLS handshake
+// asks for the certificate, the files are checked for changes if the last check is at least a minute ago, so
+// certificates rotated by cert-manager or the kubelet are picked up without reading the files on every handshake. The
+// certificate and the key are parsed together and only replace the current keypair once both are valid.
+type ClientCertificateSource struct {
+	certFile      string
+	keyFile       string
+	onRotate      func(cert *x509.Certificate, err error)
+	checkInterval time.Duration
+
+	lock      sync.Mutex
+	certData  []byte
+	keyData   []byte
+	current   *tls.Certificate
+	lastCheck time.Time
+	lastError string
+}
+
+// NewClientCertificateSource loads the keypair from the certificate and key files. The onRotate callback may be nil.
+func NewClientCertificateSource(
+	certFile string,
+	keyFile string,
+	onRotate func(cert *x509.Certificate, err error),
+) (*ClientCertificateSource, error) {
+	source := &ClientCertificateSource{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		onRotate:      onRotate,
+		checkInterval: clientCertificateCheckInterval,
+	}
+	if _, _, err := source.reload(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Current returns the keypair currently in use.
+func (s *ClientCertificateSource) Current() *tls.Certificate {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.current
+}
+
+// Reload checks the files for changes and loads the new keypair if they changed. It returns true if the keypair was
+// replaced. The rotation callback is called for every new keypair, and for an error only if it differs from the
+// previous error, so files that stay unreadable are reported once.
+func (s *ClientCertificateSource) Reload() (bool, error) {
+	cert, rotated, err := s.reload()
+	// The outcome is recorded on every reload, so a success in between resets the reported error.
+	newError := s.newError(err)
+	if s.onRotate == nil || (!rotated && !newError) {
+		return rotated, err
+	}
+	var leaf *x509.Certificate
+	if err == nil {
+		leaf = cert.Leaf
+	}
+	s.onRotate(leaf, err)
+	return rotated, err
+}
+
+// GetClientCertificate returns the current keypair and can be used as tls.Config.GetClientCertificate. The files are
+// reloaded if the check interval has passed. A failed reload is reported through the rotation callback and the
+// previous keypair is returned.
+func (s *ClientCertificateSource) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if s.checkDue() {
+		_, _ = s.Reload()
+	}
+	return s.Current(), nil
+}
+
+func (s *ClientCertificateSource) checkDue() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return time.Since(s.lastCheck) >= s.checkInterval
+}
+
+// newError records the outcome of a reload and returns true if it failed with a different error than the previous
+// reload.
+func (s *ClientCertificateSource) newError(err error) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		s.lastError = ""
+		return false
+	}
+	if err.Error() == s.lastError {
+		return false
+	}
+	s.lastError = err.Error()
+	return true
+}
+
+func (s *ClientCertificateSource) reload() (*tls.Certificate, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastCheck = time.Now()
+	certData, err := os.ReadFile(s.certFile)
+	if err != nil {
+		return s.current, false, fmt.Errorf("failed to read client certificate file %s (%w)", s.certFile, err)
+	}
+	keyData, err := os.ReadFile(s.keyFile)
+	if err != nil {
+		return s.current, false, fmt.Errorf("failed to read client key file %s (%w)", s.keyFile, err)
+	}
+	if s.current != nil && bytes.Equal(certData, s.certData) && bytes.Equal(keyData, s.keyData) {
+		return s.current, false, nil
+	}
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return s.current, false, fmt.Errorf(
+			"failed to load client certificate %s and key %s (%w)", s.certFile, s.keyFile, err)
+	}
+	s.certData = certData
+	s.keyData = keyData
+	s.current = &cert
+	return s.current, true, nil
+}
+
+// clientConfig creates the rest config for Client and RESTClient. If the connection authenticates with certificate
+// and key files, the transport serves the client certificate from a ClientCertificateSource.
+func clientConfig(connection ConnectionParameters, opts ClientOptions) (*restclient.Config, error) {
+	tlsOptions, err := clientCertificateTransportOptions(connection, opts)
+	if err != nil {
+		return nil, err
+	}
+	config, err := connectionToRestConfig(connection, tlsOptions)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeout != nil {
+		config.Timeout = *opts.Timeout
+	}
+	if opts.QPS != nil {
+		config.QPS = *opts.QPS
+	}
+	if opts.Burst != nil {
+		config.Burst = *opts.Burst
+	}
+	if opts.UserAgent != "" {
+		config.UserAgent = opts.UserAgent
+	}
+	return config, nil
+}
+
+// clientCertificateTransportOptions returns the TLS options serving the client certificate from a
+// ClientCertificateSource, if the connection authenticates with certificate and key files. The certificate files stay
+// in the rest config, so client-go still treats the connection as a TLS connection.
+func clientCertificateTransportOptions(
+	connection ConnectionParameters,
+	opts ClientOptions,
+) (tlsTransportOptions, error) {
+	if connection.CertFile == "" || connection.KeyFile == "" || connection.CertData != "" ||
+		connection.KeyData != "" || connection.Exec != nil {
+		return tlsTransportOptions{}, nil
+	}
+
+	transports := &transportSet{}
+	source, err := NewClientCertificateSource(
+		connection.CertFile,
+		connection.KeyFile,
+		func(cert *x509.Certificate, err error) {
+			if err == nil {
+				// Connections made with the previous certificate are not reused.
+				transports.closeIdleConnections()
+			}
+			if opts.OnCertificateRotation != nil {
+				opts.OnCertificateRotation(cert, err)
+			}
+		},
+	)
+	if err != nil {
+		return tlsTransportOptions{}, err
+	}
+	return tlsTransportOptions{
+		getClientCertificate: source.GetClientCertificate,
+		onTransport:          transports.add,
+	}, nil
+}
+
+// transportSet tracks the transports built for a client without keeping them alive. Transports that were garbage
+// collected are dropped whenever the set is used, so it only holds the live transports.
+type transportSet struct {
+	lock       sync.Mutex
+	transports []weak.Pointer[http.Transport]
+}
+
+func (s *transportSet) add(transport *http.Transport) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.prune()
+	s.transports = append(s.transports, weak.Make(transport))
+}
+
+// closeIdleConnections closes the idle connections of all live transports.
+func (s *transportSet) closeIdleConnections() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.prune()
+	for _, transport := range s.transports {
+		if live := transport.Value(); live != nil {
+			live.CloseIdleConnections()
+		}
+	}
+}
+
+// prune drops the transports that were garbage collected.
+func (s *transportSet) prune() {
+	live := s.transports[:0]
+	for _, transport := range s.transports {
+		if transport.Value() != nil {
+			live = append(live, transport)
+		}
+	}
+	clear(s.transports[len(live):])
+	s.transports = live
+}
@@ -0,0 +1,204 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientCertificateSource(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir, "first")
+
+	var rotations []string
+	source, err := NewClientCertificateSource(certFile, keyFile, func(cert *x509.Certificate, err error) {
+		if err != nil {
+			rotations = append(rotations, "error")
+			return
+		}
+		rotations = append(rotations, cert.Subject.CommonName)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", source.Current().Leaf.Subject.CommonName)
+
+	// test that unchanged files are not reported as a rotation
+	rotated, err := source.Reload()
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+	assert.Empty(t, rotations)
+
+	// test that the files are not checked again before the check interval passed
+	writeTestKeyPair(t, dir, "second")
+	cert, err := source.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", cert.Leaf.Subject.CommonName)
+	assert.Empty(t, rotations)
+
+	// test that a rotated keypair is served once the check interval passed
+	source.checkInterval = 0
+	cert, err = source.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", cert.Leaf.Subject.CommonName)
+	assert.Equal(t, []string{"second"}, rotations)
+
+	// test that a half-written rotation keeps the previous keypair
+	certData, _ := newTestKeyPair(t, "third")
+	assert.Nil(t, os.WriteFile(certFile, certData, 0600))
+	cert, err = source.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", cert.Leaf.Subject.CommonName)
+	assert.Equal(t, []string{"second", "error"}, rotations)
+
+	// test that the same error is reported only once
+	_, err = source.Reload()
+	assert.NotNil(t, err)
+	_, _ = source.GetClientCertificate(nil)
+	assert.Equal(t, []string{"second", "error"}, rotations)
+
+	// test that the same error is reported again after a successful rotation in between
+	writeTestKeyPair(t, dir, "fourth")
+	certData, _ = newTestKeyPair(t, "fifth")
+	_, err = source.Reload()
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(certFile, certData, 0600))
+	_, err = source.Reload()
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"second", "error", "fourth", "error"}, rotations)
+
+	// test that missing files are reported on creation
+	_, err = NewClientCertificateSource(filepath.Join(dir, "missing.crt"), keyFile, nil)
+	assert.NotNil(t, err)
+}
+
+func TestClientCertificateRotation(t *testing.T) {
+	checkInterval := clientCertificateCheckInterval
+	clientCertificateCheckInterval = 0
+	t.Cleanup(func() { clientCertificateCheckInterval = checkInterval })
+
+	var lock sync.Mutex
+	var commonNames []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		commonNames = append(commonNames, r.TLS.PeerCertificates[0].Subject.CommonName)
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir, "first")
+	var rotations []string
+	client, err := ClientWithOptions(ConnectionParameters{
+		Host:     strings.TrimPrefix(server.URL, "https://"),
+		CAData:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		// The pins share the transport with the rotating certificate, which must still close stale connections.
+		PinnedSPKISHA256: &[]string{SPKISHA256(server.Certificate())},
+	}, ClientOptions{
+		OnCertificateRotation: func(cert *x509.Certificate, err error) {
+			assert.Nil(t, err)
+			rotations = append(rotations, cert.Subject.CommonName)
+		},
+	})
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+
+	writeTestKeyPair(t, dir, "second")
+	server.CloseClientConnections()
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"first", "second"}, commonNames)
+	assert.Equal(t, []string{"second"}, rotations)
+}
+
+func TestClientOptionsOverrides(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	t.Cleanup(server.Close)
+	var connection ConnectionParameters
+	assert.Nil(t, json.Unmarshal([]byte(`{"host": "`+server.URL+`"}`), &connection))
+	// The default service account CA file does not exist outside a pod.
+	connection.CAFile = ""
+
+	// test that the schema defaults apply when the values are left empty
+	config, err := clientConfig(connection, ClientOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, config.Timeout)
+	assert.Equal(t, float32(5), config.QPS)
+	assert.Equal(t, 10, config.Burst)
+	assert.Equal(t, "Arcaflow", config.UserAgent)
+
+	// test that a connection built without the schema gets the default timeout as well
+	config, err = ConnectionToRestConfig(ConnectionParameters{Host: "127.0.0.1:6443"})
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, config.Timeout)
+
+	// test that a zero timeout in the connection disables the timeout
+	noTimeout := time.Duration(0)
+	connection.Timeout = &noTimeout
+	config, err = clientConfig(connection, ClientOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), config.Timeout)
+
+	// test that the connection values are overridden per client, including disabling the timeout
+	connectionTimeout := time.Minute
+	connection.Timeout = &connectionTimeout
+	connection.QPS = 20
+	connection.Burst = 40
+	connection.UserAgent = "my-plugin/1.0"
+	timeout := time.Duration(0)
+	qps := float32(50)
+	burst := 100
+	config, err = clientConfig(connection, ClientOptions{
+		Timeout:   &timeout,
+		QPS:       &qps,
+		Burst:     &burst,
+		UserAgent: "my-plugin/1.0 (watch)",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), config.Timeout)
+	assert.Equal(t, float32(50), config.QPS)
+	assert.Equal(t, 100, config.Burst)
+
+	client, err := ClientWithOptions(connection, ClientOptions{UserAgent: "my-plugin/1.0 (watch)"})
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "my-plugin/1.0 (watch)", userAgent)
+}
+
+func TestTransportSet(t *testing.T) {
+	transports := &transportSet{}
+	for i := 0; i < 10; i++ {
+		transports.add(&http.Transport{})
+	}
+	live := &http.Transport{}
+	runtime.GC()
+
+	// test that only the live transports are tracked
+	transports.add(live)
+	assert.Len(t, transports.transports, 1)
+	transports.closeIdleConnections()
+	runtime.KeepAlive(live)
+}
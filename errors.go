@@ -0,0 +1,100 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ContextNotFoundError indicates that a context referenced by name is not present in the kubeconfig.
+type ContextNotFoundError struct {
+	Name string
+}
+
+func (e *ContextNotFoundError) Error() string {
+	return fmt.Sprintf("context %s not found in kubeconfig file", e.Name)
+}
+
+// ClusterNotFoundError indicates that a cluster referenced by name is not present in the kubeconfig.
+type ClusterNotFoundError struct {
+	Name string
+}
+
+func (e *ClusterNotFoundError) Error() string {
+	return fmt.Sprintf("cluster %s not found in kubeconfig file", e.Name)
+}
+
+// UserNotFoundError indicates that a user referenced by name is not present in the kubeconfig.
+type UserNotFoundError struct {
+	Name string
+}
+
+func (e *UserNotFoundError) Error() string {
+	return fmt.Sprintf("user %s not found in kubeconfig file", e.Name)
+}
+
+// MissingServerError indicates that a cluster or a connection has no server to connect to. The cluster name is empty
+// if the error stems from connection parameters rather than a kubeconfig cluster.
+type MissingServerError struct {
+	Cluster string
+}
+
+func (e *MissingServerError) Error() string {
+	if e.Cluster == "" {
+		return "no cluster host found in connection"
+	}
+	return fmt.Sprintf("cluster %s has no server set in kubeconfig file", e.Cluster)
+}
+
+// CredentialFileError indicates that a certificate, key or token file referenced by a kubeconfig or mounted as part
+// of a service account could not be read.
+// The underlying error, for example os.ErrNotExist, is available through errors.Is and errors.As.
+type CredentialFileError struct {
+	Path string
+	Err  error
+}
+
+func (e *CredentialFileError) Error() string {
+	return fmt.Sprintf("failed to read credential file %s (%v)", e.Path, e.Err)
+}
+
+func (e *CredentialFileError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNoCurrentContext indicates that a kubeconfig has no current context and no context was selected otherwise.
+var ErrNoCurrentContext = errors.New("unusable KubeConfig: no current context is set")
+
+// ErrNotInCluster indicates that the process is not running inside a Kubernetes pod, so no in-cluster connection can
+// be built.
+var ErrNotInCluster = errors.New("not running inside a Kubernetes cluster: KUBERNETES_SERVICE_HOST and " +
+	"KUBERNETES_SERVICE_PORT must be set")
+
+// ErrKubeConfigNotFound indicates that none of the kubeconfig files to load exist.
+var ErrKubeConfigNotFound = errors.New("no kubeconfig file found")
+
+// ConnectionCheckError indicates that a stage of CheckConnection failed.
+type ConnectionCheckError struct {
+	Stage ConnectionCheckStage
+	Err   error
+}
+
+func (e *ConnectionCheckError) Error() string {
+	return fmt.Sprintf("connection check failed at the %s stage (%v)", e.Stage, e.Err)
+}
+
+func (e *ConnectionCheckError) Unwrap() error {
+	return e.Err
+}
+
+// PinnedSPKIMismatchError indicates that the server certificate chain contains none of the pinned public keys of the
+// connection. Subject is the subject of the server certificate.
+type PinnedSPKIMismatchError struct {
+	Subject string
+}
+
+func (e *PinnedSPKIMismatchError) Error() string {
+	if e.Subject == "" {
+		return "the server presented no certificate to match the pinned public keys against"
+	}
+	return fmt.Sprintf("the certificate chain of the server %s contains none of the pinned public keys", e.Subject)
+}
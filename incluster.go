@@ -0,0 +1,79 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultServiceAccountDir is the directory Kubernetes mounts the service account credentials of a pod into.
+const DefaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+const defaultNamespace = "default"
+
+// InClusterOptions holds the options for InClusterConnection.
+type InClusterOptions struct {
+	// ServiceAccountDir is the directory holding the token, ca.crt and namespace files. Defaults to
+	// DefaultServiceAccountDir.
+	ServiceAccountDir string
+	// InlineFiles reads the CA certificate into the connection instead of referencing the file.
+	InlineFiles bool
+}
+
+// InClusterConnection builds connection parameters for a process running inside a pod from the
+// KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT environment variables and the mounted service account. The
+// token file is referenced rather than read into the connection, so rotated tokens are picked up. The
+// namespace of the service account, or "default" if the namespace file is absent, is set on the connection and
+// returned as well. If the environment variables are not set, ErrNotInCluster is returned. Service account files
+// that cannot be read are reported as a CredentialFileError.
+func InClusterConnection(opts InClusterOptions) (ConnectionParameters, string, error) {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return ConnectionParameters{}, "", ErrNotInCluster
+	}
+	dir := opts.ServiceAccountDir
+	if dir == "" {
+		dir = DefaultServiceAccountDir
+	}
+
+	tokenFile := filepath.Join(dir, "token")
+	if _, err := os.ReadFile(tokenFile); err != nil {
+		return ConnectionParameters{}, "", &CredentialFileError{Path: tokenFile, Err: err}
+	}
+	connectionParams := ConnectionParameters{
+		Host:            net.JoinHostPort(host, port),
+		BearerTokenFile: tokenFile,
+	}
+
+	caFile := filepath.Join(dir, "ca.crt")
+	if opts.InlineFiles {
+		caData, err := os.ReadFile(caFile)
+		if err != nil {
+			return ConnectionParameters{}, "", &CredentialFileError{Path: caFile, Err: err}
+		}
+		connectionParams.CAData = string(caData)
+	} else {
+		if _, err := os.Stat(caFile); err != nil {
+			return ConnectionParameters{}, "", &CredentialFileError{Path: caFile, Err: err}
+		}
+		connectionParams.CAFile = caFile
+	}
+
+	connectionParams.Namespace = defaultNamespace
+	namespaceFile := filepath.Join(dir, "namespace")
+	namespaceData, err := os.ReadFile(namespaceFile)
+	switch {
+	case err == nil && len(strings.TrimSpace(string(namespaceData))) > 0:
+		connectionParams.Namespace = strings.TrimSpace(string(namespaceData))
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return ConnectionParameters{}, "", &CredentialFileError{Path: namespaceFile, Err: err}
+	}
+
+	if err := ConnectionParametersSchema().Validate(connectionParams); err != nil {
+		return ConnectionParameters{}, "", err
+	}
+	return connectionParams, connectionParams.Namespace, nil
+}
@@ -0,0 +1,84 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeServiceAccount(t *testing.T, fixtures testFixtures, namespace string) string {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "token"), []byte(fixtures.tokenFile+"\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "ca.crt"), []byte(fixtures.caCert), 0600))
+	if namespace != "" {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte(namespace), 0600))
+	}
+	return dir
+}
+
+func TestInClusterConnection(t *testing.T) {
+	fixtures := NewFixtures(t)
+	dir := writeServiceAccount(t, fixtures, "plugins")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+	connection, namespace, err := InClusterConnection(InClusterOptions{ServiceAccountDir: dir})
+	assert.Nil(t, err)
+	assert.Equal(t, "plugins", namespace)
+	assert.Equal(t, "plugins", connection.Namespace)
+	assert.Equal(t, "10.96.0.1:443", connection.Host)
+	assert.Empty(t, connection.BearerToken)
+	assert.Equal(t, filepath.Join(dir, "token"), connection.BearerTokenFile)
+	assert.Equal(t, filepath.Join(dir, "ca.crt"), connection.CAFile)
+	assert.Empty(t, connection.CAData)
+
+	// test inlining the CA certificate
+	connection, _, err = InClusterConnection(InClusterOptions{ServiceAccountDir: dir, InlineFiles: true})
+	assert.Nil(t, err)
+	assert.Equal(t, fixtures.caCert, connection.CAData)
+	assert.Empty(t, connection.CAFile)
+
+	// test IPv6 service hosts and the default namespace
+	dir = writeServiceAccount(t, fixtures, "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "fd00::1")
+	connection, namespace, err = InClusterConnection(InClusterOptions{ServiceAccountDir: dir})
+	assert.Nil(t, err)
+	assert.Equal(t, "[fd00::1]:443", connection.Host)
+	assert.Equal(t, "default", namespace)
+}
+
+func TestInClusterConnectionErrors(t *testing.T) {
+	fixtures := NewFixtures(t)
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+	// test typed errors for a missing token
+	dir := writeServiceAccount(t, fixtures, "")
+	tokenFile := filepath.Join(dir, "token")
+	assert.Nil(t, os.Remove(tokenFile))
+	var fileErr *CredentialFileError
+	_, _, err := InClusterConnection(InClusterOptions{ServiceAccountDir: dir})
+	assert.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, tokenFile, fileErr.Path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// test typed errors for a missing CA certificate, with and without inlining
+	dir = writeServiceAccount(t, fixtures, "")
+	caFile := filepath.Join(dir, "ca.crt")
+	assert.Nil(t, os.Remove(caFile))
+	for _, inlineFiles := range []bool{false, true} {
+		_, _, err = InClusterConnection(InClusterOptions{ServiceAccountDir: dir, InlineFiles: inlineFiles})
+		assert.ErrorAs(t, err, &fileErr)
+		assert.Equal(t, caFile, fileErr.Path)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
+func TestInClusterConnectionNotInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	_, _, err := InClusterConnection(InClusterOptions{ServiceAccountDir: t.TempDir()})
+	assert.True(t, errors.Is(err, ErrNotInCluster))
+}
@@ -0,0 +1,315 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// LintSeverity is the severity of a security finding. Pipelines typically block on LintSeverityHigh.
+type LintSeverity string
+
+const (
+	// LintSeverityLow marks a finding that weakens security only slightly or under unusual circumstances.
+	LintSeverityLow LintSeverity = "low"
+	// LintSeverityMedium marks a finding that weakens security and should be fixed.
+	LintSeverityMedium LintSeverity = "medium"
+	// LintSeverityHigh marks a finding that exposes credentials or the connection to attackers.
+	LintSeverityHigh LintSeverity = "high"
+)
+
+var lintSeverityRank = map[LintSeverity]int{
+	LintSeverityLow:    1,
+	LintSeverityMedium: 2,
+	LintSeverityHigh:   3,
+}
+
+// AtLeast returns true if the severity is the same as or more severe than the given minimum.
+func (s LintSeverity) AtLeast(minimum LintSeverity) bool {
+	return lintSeverityRank[s] >= lintSeverityRank[minimum]
+}
+
+// The rules reported by LintKubeConfig and LintConnection.
+const (
+	// LintRuleInsecureSkipTLSVerify reports disabled verification of the server certificate.
+	LintRuleInsecureSkipTLSVerify = "insecure-skip-tls-verify"
+	// LintRulePlainHTTP reports servers reached over plain HTTP.
+	LintRulePlainHTTP = "plain-http"
+	// LintRuleBasicAuth reports authentication with a username and password.
+	LintRuleBasicAuth = "basic-auth"
+	// LintRuleCertificateExpired reports certificates past their expiry.
+	LintRuleCertificateExpired = "certificate-expired"
+	// LintRuleCertificateExpiring reports certificates expiring within the expiry warning period.
+	LintRuleCertificateExpiring = "certificate-expiring"
+	// LintRuleCAMismatch reports client certificates not issued by the CA of the cluster.
+	LintRuleCAMismatch = "ca-mismatch"
+	// LintRuleWeakRSAKey reports RSA keys shorter than the minimum key size.
+	LintRuleWeakRSAKey = "weak-rsa-key"
+	// LintRuleKeyFilePermissions reports key files readable by other users.
+	LintRuleKeyFilePermissions = "key-file-permissions"
+)
+
+// LintFinding is a security problem found in a kubeconfig or a connection. The path points to the offending field,
+// using the field names of the kubeconfig or the connection schema respectively.
+type LintFinding struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Path     string       `json:"path"`
+	Message  string       `json:"message"`
+}
+
+// LintOptions holds the options for LintKubeConfig and LintConnection.
+type LintOptions struct {
+	// Now is the time certificates are checked against. Defaults to the current time.
+	Now time.Time
+	// ExpiryWarning is how long before their expiry certificates are reported as expiring. Defaults to 30 days.
+	ExpiryWarning time.Duration
+	// MinRSAKeyBits is the smallest RSA key size that is not reported as weak. Defaults to 2048.
+	MinRSAKeyBits int
+}
+
+func (o LintOptions) withDefaults() LintOptions {
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	if o.ExpiryWarning == 0 {
+		o.ExpiryWarning = 30 * 24 * time.Hour
+	}
+	if o.MinRSAKeyBits == 0 {
+		o.MinRSAKeyBits = 2048
+	}
+	return o
+}
+
+// LintKubeConfig checks the kubeconfig for insecure settings. Structural problems such as unreadable files or
+// malformed certificates are not reported, use ValidateKubeConfig for those.
+func LintKubeConfig(kubeconfig KubeConfig, opts LintOptions) []LintFinding {
+	l := &linter{opts: opts.withDefaults()}
+
+	clusterCAs := map[string][]*x509.Certificate{}
+	for i, cluster := range kubeconfig.Clusters {
+		path := fmt.Sprintf("clusters[%d].cluster", i)
+		origin := cluster.Origin
+		if origin == "" {
+			origin = kubeconfig.Origin
+		}
+		l.checkTransport(path+".server", cluster.Cluster.Server, path+".insecure-skip-tls-verify",
+			cluster.Cluster.InsecureSkipTLSVerify)
+		caPath, caCerts := lintKubeConfigCertificates(
+			path, "certificate-authority", cluster.Cluster.CertificateAuthority,
+			cluster.Cluster.CertificateAuthorityData, origin,
+		)
+		l.checkCertificates(caPath, caCerts)
+		if _, ok := clusterCAs[cluster.Name]; !ok {
+			clusterCAs[cluster.Name] = caCerts
+		}
+	}
+
+	userCerts := map[string][]*x509.Certificate{}
+	for i, user := range kubeconfig.Users {
+		path := fmt.Sprintf("users[%d].user", i)
+		origin := user.Origin
+		if origin == "" {
+			origin = kubeconfig.Origin
+		}
+		l.checkBasicAuth(path+".username", user.User.Username != nil && *user.User.Username != "")
+		certPath, certs := lintKubeConfigCertificates(
+			path, "client-certificate", user.User.ClientCertificate, user.User.ClientCertificateData, origin,
+		)
+		l.checkCertificates(certPath, certs)
+		if user.User.ClientKey != nil && user.User.ClientKeyData == nil {
+			if keyFile, err := resolveKubeConfigPath(*user.User.ClientKey, origin); err == nil {
+				l.checkKeyFile(path+".client-key", keyFile)
+			}
+		}
+		if _, ok := userCerts[user.Name]; !ok {
+			userCerts[user.Name] = certs
+		}
+	}
+
+	for i, context := range kubeconfig.Contexts {
+		l.checkCAMismatch(
+			fmt.Sprintf("contexts[%d]", i),
+			clusterCAs[context.Context.Cluster],
+			userCerts[context.Context.User],
+		)
+	}
+	return l.findings
+}
+
+// LintConnection checks the connection for insecure settings. Unreadable files and malformed certificates are skipped.
+func LintConnection(connection ConnectionParameters, opts LintOptions) []LintFinding {
+	l := &linter{opts: opts.withDefaults()}
+	l.checkTransport("host", connection.Host, "insecure", connection.Insecure)
+	l.checkBasicAuth("username", connection.Username != "")
+
+	caPath, caCerts := lintConnectionCertificates("cacert", connection.CAData, connection.CAFile)
+	l.checkCertificates(caPath, caCerts)
+	certPath, certs := lintConnectionCertificates("cert", connection.CertData, connection.CertFile)
+	l.checkCertificates(certPath, certs)
+	if connection.KeyData == "" && connection.KeyFile != "" {
+		l.checkKeyFile("keyFile", connection.KeyFile)
+	}
+	l.checkCAMismatch(certPath, caCerts, certs)
+	return l.findings
+}
+
+type linter struct {
+	opts     LintOptions
+	findings []LintFinding
+}
+
+func (l *linter) report(rule string, severity LintSeverity, path string, format string, args ...any) {
+	l.findings = append(l.findings, LintFinding{
+		Rule:     rule,
+		Severity: severity,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) checkTransport(serverPath string, server string, insecurePath string, insecure bool) {
+	if strings.HasPrefix(server, "http://") {
+		l.report(LintRulePlainHTTP, LintSeverityHigh, serverPath,
+			"the server %s is accessed over plain HTTP, credentials and data are sent unencrypted", server)
+	} else if insecure {
+		l.report(LintRuleInsecureSkipTLSVerify, LintSeverityHigh, insecurePath,
+			"TLS verification is disabled, the server identity is not checked")
+	}
+}
+
+func (l *linter) checkBasicAuth(path string, basicAuth bool) {
+	if basicAuth {
+		l.report(LintRuleBasicAuth, LintSeverityMedium, path,
+			"basic authentication uses a static password, prefer client certificates or tokens")
+	}
+}
+
+func (l *linter) checkCertificates(path string, certs []*x509.Certificate) {
+	for _, cert := range certs {
+		subject := cert.Subject.String()
+		switch {
+		case l.opts.Now.After(cert.NotAfter):
+			l.report(LintRuleCertificateExpired, LintSeverityHigh, path,
+				"the certificate %s expired on %s", subject, cert.NotAfter.Format(time.RFC3339))
+		case l.opts.Now.Add(l.opts.ExpiryWarning).After(cert.NotAfter):
+			l.report(LintRuleCertificateExpiring, LintSeverityMedium, path,
+				"the certificate %s expires on %s", subject, cert.NotAfter.Format(time.RFC3339))
+		}
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < l.opts.MinRSAKeyBits {
+			l.report(LintRuleWeakRSAKey, LintSeverityHigh, path,
+				"the certificate %s uses a %d bit RSA key, at least %d bits are required",
+				subject, key.N.BitLen(), l.opts.MinRSAKeyBits)
+		}
+	}
+}
+
+// checkKeyFile reports key files other users can read. File permissions are not checked on Windows.
+func (l *linter) checkKeyFile(path string, keyFile string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		return
+	}
+	switch mode := info.Mode().Perm(); {
+	case mode&0o004 != 0:
+		l.report(LintRuleKeyFilePermissions, LintSeverityHigh, path,
+			"the key file %s is world-readable (mode %04o)", keyFile, mode)
+	case mode&0o040 != 0:
+		l.report(LintRuleKeyFilePermissions, LintSeverityLow, path,
+			"the key file %s is group-readable (mode %04o)", keyFile, mode)
+	}
+}
+
+// checkCAMismatch reports client certificates that were not issued by the certificate authority of the cluster. This
+// usually means the client certificate belongs to a different cluster.
+func (l *linter) checkCAMismatch(path string, caCerts []*x509.Certificate, clientCerts []*x509.Certificate) {
+	if len(caCerts) == 0 || len(clientCerts) == 0 {
+		return
+	}
+	if !certificateIssuedBy(clientCerts[0], clientCerts[1:], caCerts) {
+		l.report(LintRuleCAMismatch, LintSeverityMedium, path,
+			"the client certificate %s is not issued by the cluster certificate authority %s",
+			clientCerts[0].Subject.String(), caCerts[0].Subject.String())
+	}
+}
+
+// certificateIssuedBy checks if the certificate is signed by one of the roots, directly or through the intermediates.
+// Validity periods are not checked, expired certificates are reported separately.
+func certificateIssuedBy(cert *x509.Certificate, intermediates []*x509.Certificate, roots []*x509.Certificate) bool {
+	for _, root := range roots {
+		if cert.Equal(root) || cert.CheckSignatureFrom(root) == nil {
+			return true
+		}
+	}
+	for i, intermediate := range intermediates {
+		if cert.CheckSignatureFrom(intermediate) != nil {
+			continue
+		}
+		remaining := append(append([]*x509.Certificate{}, intermediates[:i]...), intermediates[i+1:]...)
+		if certificateIssuedBy(intermediate, remaining, roots) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintKubeConfigCertificates loads the certificates of a kubeconfig field pair like client-certificate and
+// client-certificate-data and returns the path of the field they were loaded from.
+func lintKubeConfigCertificates(
+	path string,
+	field string,
+	file *string,
+	data *string,
+	origin string,
+) (string, []*x509.Certificate) {
+	if data != nil {
+		decoded, err := base64.StdEncoding.DecodeString(*data)
+		if err != nil {
+			return path + "." + field + "-data", nil
+		}
+		return path + "." + field + "-data", parseLintCertificates(decoded)
+	}
+	if file != nil {
+		resolved, err := resolveKubeConfigPath(*file, origin)
+		if err != nil {
+			return path + "." + field, nil
+		}
+		fileData, err := os.ReadFile(resolved)
+		if err != nil {
+			return path + "." + field, nil
+		}
+		return path + "." + field, parseLintCertificates(fileData)
+	}
+	return path + "." + field, nil
+}
+
+// lintConnectionCertificates loads the certificates of a connection field pair like cert and certFile and returns the
+// field they were loaded from.
+func lintConnectionCertificates(field string, data string, file string) (string, []*x509.Certificate) {
+	if data != "" {
+		return field, parseLintCertificates([]byte(data))
+	}
+	if file != "" {
+		fileData, err := os.ReadFile(file)
+		if err != nil {
+			return field + "File", nil
+		}
+		return field + "File", parseLintCertificates(fileData)
+	}
+	return field, nil
+}
+
+// parseLintCertificates parses the certificates to lint. Malformed certificates are a validation problem reported by
+// ValidateKubeConfig rather than a security finding, so they are skipped.
+func parseLintCertificates(data []byte) []*x509.Certificate {
+	certs, _ := parseCertificatesPEM(data)
+	return certs
+}
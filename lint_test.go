@@ -0,0 +1,140 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var lintTestNow = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestLintKubeConfig(t *testing.T) {
+	notBefore := lintTestNow.AddDate(-1, 0, 0)
+	ca := newTestCA(t, "ca", nil, notBefore, lintTestNow.AddDate(5, 0, 0))
+	otherCA := newTestCA(t, "other-ca", nil, notBefore, lintTestNow.AddDate(5, 0, 0))
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+
+	validCert := newTestClientCertificate(t, "valid", newTestKey(t), ca, notBefore, lintTestNow.AddDate(1, 0, 0))
+	expiredCert := newTestClientCertificate(t, "expired", newTestKey(t), ca, notBefore, lintTestNow.Add(-time.Hour))
+	expiringCert := newTestClientCertificate(t, "expiring", newTestKey(t), ca, notBefore, lintTestNow.Add(24*time.Hour))
+	weakCert := newTestClientCertificate(t, "weak", weakKey, otherCA, notBefore, lintTestNow.AddDate(1, 0, 0))
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "client.key")
+	assert.Nil(t, os.WriteFile(keyFile, []byte("key"), 0600))
+	assert.Nil(t, os.Chmod(keyFile, 0644))
+	secureKeyFile := filepath.Join(dir, "secure.key")
+	assert.Nil(t, os.WriteFile(secureKeyFile, []byte("key"), 0600))
+
+	encode := func(cert *x509.Certificate) *string {
+		data := base64.StdEncoding.EncodeToString([]byte(certificatePEM(cert)))
+		return &data
+	}
+	username := "admin"
+	kubeconf := KubeConfig{
+		Clusters: []KubeConfigCluster{
+			{Name: "secure", Cluster: KubeConfigClusterParams{
+				Server:                   "https://127.0.0.1:6443",
+				CertificateAuthorityData: encode(ca.cert),
+			}},
+			{Name: "insecure", Cluster: KubeConfigClusterParams{
+				Server:                "https://127.0.0.1:6443",
+				InsecureSkipTLSVerify: true,
+			}},
+			{Name: "plain", Cluster: KubeConfigClusterParams{Server: "http://127.0.0.1:8080"}},
+		},
+		Users: []KubeConfigUser{
+			{Name: "valid", User: KubeConfigUserParameters{
+				ClientCertificateData: encode(validCert),
+				ClientKey:             &secureKeyFile,
+			}},
+			{Name: "expired", User: KubeConfigUserParameters{ClientCertificateData: encode(expiredCert)}},
+			{Name: "expiring", User: KubeConfigUserParameters{ClientCertificateData: encode(expiringCert)}},
+			{Name: "weak", User: KubeConfigUserParameters{
+				ClientCertificateData: encode(weakCert),
+				ClientKey:             &keyFile,
+			}},
+			{Name: "basic", User: KubeConfigUserParameters{Username: &username}},
+		},
+		Contexts: []KubeConfigContext{
+			{Name: "valid", Context: KubeConfigContextParameters{Cluster: "secure", User: "valid"}},
+			{Name: "expired", Context: KubeConfigContextParameters{Cluster: "secure", User: "expired"}},
+			{Name: "weak", Context: KubeConfigContextParameters{Cluster: "secure", User: "weak"}},
+			{Name: "insecure", Context: KubeConfigContextParameters{Cluster: "insecure", User: "weak"}},
+		},
+	}
+
+	type finding struct {
+		Rule     string
+		Severity LintSeverity
+		Path     string
+	}
+	var findings []finding
+	for _, f := range LintKubeConfig(kubeconf, LintOptions{Now: lintTestNow}) {
+		assert.NotEmpty(t, f.Message)
+		findings = append(findings, finding{f.Rule, f.Severity, f.Path})
+	}
+	expected := []finding{
+		{LintRuleInsecureSkipTLSVerify, LintSeverityHigh, "clusters[1].cluster.insecure-skip-tls-verify"},
+		{LintRulePlainHTTP, LintSeverityHigh, "clusters[2].cluster.server"},
+		{LintRuleCertificateExpired, LintSeverityHigh, "users[1].user.client-certificate-data"},
+		{LintRuleCertificateExpiring, LintSeverityMedium, "users[2].user.client-certificate-data"},
+		{LintRuleWeakRSAKey, LintSeverityHigh, "users[3].user.client-certificate-data"},
+		{LintRuleBasicAuth, LintSeverityMedium, "users[4].user.username"},
+		{LintRuleCAMismatch, LintSeverityMedium, "contexts[2]"},
+	}
+	if runtime.GOOS != "windows" {
+		expected = append(expected[:5], append(
+			[]finding{{LintRuleKeyFilePermissions, LintSeverityHigh, "users[3].user.client-key"}},
+			expected[5:]...,
+		)...)
+	}
+	assert.Equal(t, expected, findings)
+
+	// test that the findings are machine-readable
+	data, err := json.Marshal(LintKubeConfig(kubeconf, LintOptions{Now: lintTestNow})[0])
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"rule":"insecure-skip-tls-verify","severity":"high"`)
+}
+
+func TestLintConnection(t *testing.T) {
+	notBefore := lintTestNow.AddDate(-1, 0, 0)
+	ca := newTestCA(t, "ca", nil, notBefore, lintTestNow.AddDate(5, 0, 0))
+	cert := newTestClientCertificate(t, "client", newTestKey(t), ca, notBefore, lintTestNow.AddDate(1, 0, 0))
+
+	assert.Empty(t, LintConnection(ConnectionParameters{
+		Host:     "127.0.0.1:6443",
+		CAData:   certificatePEM(ca.cert),
+		CertData: certificatePEM(cert),
+	}, LintOptions{Now: lintTestNow}))
+
+	findings := LintConnection(ConnectionParameters{
+		Host:     "127.0.0.1:6443",
+		Insecure: true,
+		Username: "admin",
+		Password: "secret",
+		CertData: certificatePEM(ca.cert),
+	}, LintOptions{Now: lintTestNow.AddDate(6, 0, 0)})
+	var rules []string
+	for _, finding := range findings {
+		rules = append(rules, finding.Rule+"@"+finding.Path)
+	}
+	assert.Equal(t, []string{
+		LintRuleInsecureSkipTLSVerify + "@insecure",
+		LintRuleBasicAuth + "@username",
+		LintRuleCertificateExpired + "@cert",
+	}, rules)
+
+	assert.True(t, LintSeverityHigh.AtLeast(LintSeverityMedium))
+	assert.True(t, LintSeverityMedium.AtLeast(LintSeverityMedium))
+	assert.False(t, LintSeverityLow.AtLeast(LintSeverityHigh))
+}
@@ -0,0 +1,109 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// KubeConfigEnv is the environment variable holding the list of kubeconfig files to merge.
+const KubeConfigEnv = "KUBECONFIG"
+
+// LoadKubeConfigFiles reads and merges the given kubeconfig files. Clusters, contexts and users are merged by name
+// and, like in kubectl, the first file to define a name wins. The current context and the preferences are taken from
+// the first file that sets them. Each merged entry records the file it was loaded from in its Origin field. Empty
+// and duplicate paths are skipped, any other path that cannot be read or parsed results in an error. The Origin of the
+// merged kubeconfig is the first file loaded.
+func LoadKubeConfigFiles(paths ...string) (KubeConfig, error) {
+	return loadKubeConfigFiles(paths, false)
+}
+
+// LoadKubeConfigFromEnv splits the KUBECONFIG environment variable on the OS path list separator and merges the
+// listed files with LoadKubeConfigFiles. As in kubectl, entries whose file does not exist are skipped without an
+// error, so a KUBECONFIG listing files that are only created later, for example by a login command, still works.
+// ErrKubeConfigNotFound is returned only if the variable is unset or none of the listed files exist. Files that exist
+// but cannot be read or parsed still result in an error.
+func LoadKubeConfigFromEnv() (KubeConfig, error) {
+	value := os.Getenv(KubeConfigEnv)
+	if value == "" {
+		return KubeConfig{}, fmt.Errorf("the %s environment variable is not set (%w)", KubeConfigEnv, ErrKubeConfigNotFound)
+	}
+	kubeconfig, err := loadKubeConfigFiles(filepath.SplitList(value), true)
+	if errors.Is(err, ErrKubeConfigNotFound) {
+		return KubeConfig{}, fmt.Errorf("none of the files in %s exist (%w)", KubeConfigEnv, err)
+	}
+	return kubeconfig, err
+}
+
+func loadKubeConfigFiles(paths []string, ignoreMissing bool) (KubeConfig, error) {
+	merged := KubeConfig{
+		Kind:       "Config",
+		APIVersion: "v1",
+	}
+	seenPaths := map[string]struct{}{}
+	seenClusters := map[string]struct{}{}
+	seenContexts := map[string]struct{}{}
+	seenUsers := map[string]struct{}{}
+	loaded := 0
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, ok := seenPaths[path]; ok {
+			continue
+		}
+		seenPaths[path] = struct{}{}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if ignoreMissing && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return KubeConfig{}, fmt.Errorf("failed to read kubeconfig file %s (%w)", path, err)
+		}
+		kubeconfig, err := ParseKubeConfig(string(data))
+		if err != nil {
+			return KubeConfig{}, fmt.Errorf("failed to parse kubeconfig file %s (%w)", path, err)
+		}
+		loaded++
+		if merged.Origin == "" {
+			merged.Origin = path
+		}
+
+		for _, cluster := range kubeconfig.Clusters {
+			if _, ok := seenClusters[cluster.Name]; ok {
+				continue
+			}
+			seenClusters[cluster.Name] = struct{}{}
+			cluster.Origin = path
+			merged.Clusters = append(merged.Clusters, cluster)
+		}
+		for _, context := range kubeconfig.Contexts {
+			if _, ok := seenContexts[context.Name]; ok {
+				continue
+			}
+			seenContexts[context.Name] = struct{}{}
+			context.Origin = path
+			merged.Contexts = append(merged.Contexts, context)
+		}
+		for _, user := range kubeconfig.Users {
+			if _, ok := seenUsers[user.Name]; ok {
+				continue
+			}
+			seenUsers[user.Name] = struct{}{}
+			user.Origin = path
+			merged.Users = append(merged.Users, user)
+		}
+		if merged.CurrentContext == nil && kubeconfig.CurrentContext != nil {
+			merged.CurrentContext = kubeconfig.CurrentContext
+		}
+		if merged.Preferences == nil {
+			merged.Preferences = kubeconfig.Preferences
+		}
+	}
+	if loaded == 0 {
+		return KubeConfig{}, ErrKubeConfigNotFound
+	}
+	return merged, nil
+}
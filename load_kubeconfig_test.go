@@ -0,0 +1,206 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const firstKubeConfig = `apiVersion: v1
+clusters:
+  - cluster:
+      server: https://first.example.com:6443
+    name: shared
+contexts:
+  - context:
+      cluster: shared
+      user: first
+    name: first
+current-context: first
+kind: Config
+users:
+  - name: first
+    user:
+      token: first-token
+`
+
+const secondKubeConfig = `apiVersion: v1
+clusters:
+  - cluster:
+      server: https://second.example.com:6443
+    name: shared
+  - cluster:
+      server: https://other.example.com:6443
+    name: other
+contexts:
+  - context:
+      cluster: other
+      user: second
+    name: second
+current-context: second
+kind: Config
+users:
+  - name: first
+    user:
+      token: overridden-token
+  - name: second
+    user:
+      token: second-token
+`
+
+func writeTestKubeConfigs(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.yaml")
+	second := filepath.Join(dir, "second.yaml")
+	assert.Nil(t, os.WriteFile(first, []byte(firstKubeConfig), 0600))
+	assert.Nil(t, os.WriteFile(second, []byte(secondKubeConfig), 0600))
+	return first, second
+}
+
+func assertMergedKubeConfig(t *testing.T, kubeconf KubeConfig, first string, second string) {
+	assert.Equal(t, "first", *kubeconf.CurrentContext)
+
+	assert.Len(t, kubeconf.Clusters, 2)
+	assert.Equal(t, "shared", kubeconf.Clusters[0].Name)
+	assert.Equal(t, "https://first.example.com:6443", kubeconf.Clusters[0].Cluster.Server)
+	assert.Equal(t, first, kubeconf.Clusters[0].Origin)
+	assert.Equal(t, "other", kubeconf.Clusters[1].Name)
+	assert.Equal(t, second, kubeconf.Clusters[1].Origin)
+
+	assert.Len(t, kubeconf.Users, 2)
+	assert.Equal(t, "first-token", *kubeconf.Users[0].User.Token)
+	assert.Equal(t, first, kubeconf.Users[0].Origin)
+	assert.Equal(t, second, kubeconf.Users[1].Origin)
+
+	assert.Len(t, kubeconf.Contexts, 2)
+	assert.Equal(t, first, kubeconf.Contexts[0].Origin)
+	assert.Equal(t, second, kubeconf.Contexts[1].Origin)
+}
+
+func TestLoadKubeConfigFiles(t *testing.T) {
+	first, second := writeTestKubeConfigs(t)
+
+	kubeconf, err := LoadKubeConfigFiles(first, "", second, first)
+	assert.Nil(t, err)
+	assertMergedKubeConfig(t, kubeconf, first, second)
+
+	// test that the merged kubeconfig converts to the connection of the first file
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "first.example.com:6443", connection.Host)
+	assert.Equal(t, "first-token", connection.BearerToken)
+
+	// test that the order of the files determines the winner
+	kubeconf, err = LoadKubeConfigFiles(second, first)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", *kubeconf.CurrentContext)
+	assert.Equal(t, "https://second.example.com:6443", kubeconf.Clusters[0].Cluster.Server)
+
+	// test failure on missing and invalid files
+	_, err = LoadKubeConfigFiles(first, filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.NotNil(t, err)
+	invalid := filepath.Join(t.TempDir(), "invalid.yaml")
+	assert.Nil(t, os.WriteFile(invalid, []byte("clusters: invalid"), 0600))
+	_, err = LoadKubeConfigFiles(first, invalid)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), invalid)
+	_, err = LoadKubeConfigFiles()
+	assert.NotNil(t, err)
+}
+
+func TestLoadKubeConfigFromEnv(t *testing.T) {
+	first, second := writeTestKubeConfigs(t)
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	t.Setenv(KubeConfigEnv, strings.Join([]string{missing, first, second}, string(filepath.ListSeparator)))
+	kubeconf, err := LoadKubeConfigFromEnv()
+	assert.Nil(t, err)
+	assertMergedKubeConfig(t, kubeconf, first, second)
+
+	// test that a missing file between existing files is skipped
+	t.Setenv(KubeConfigEnv, strings.Join([]string{first, missing, second}, string(filepath.ListSeparator)))
+	kubeconf, err = LoadKubeConfigFromEnv()
+	assert.Nil(t, err)
+	assertMergedKubeConfig(t, kubeconf, first, second)
+
+	// test that ErrKubeConfigNotFound is returned only when none of the files exist
+	otherMissing := filepath.Join(t.TempDir(), "other", "missing.yaml")
+	t.Setenv(KubeConfigEnv, strings.Join([]string{missing, otherMissing}, string(filepath.ListSeparator)))
+	_, err = LoadKubeConfigFromEnv()
+	assert.ErrorIs(t, err, ErrKubeConfigNotFound)
+
+	// test failure when the variable is not set
+	t.Setenv(KubeConfigEnv, "")
+	_, err = LoadKubeConfigFromEnv()
+	assert.ErrorIs(t, err, ErrKubeConfigNotFound)
+
+	// test that an existing file that cannot be parsed is not skipped
+	invalid := filepath.Join(t.TempDir(), "invalid.yaml")
+	assert.Nil(t, os.WriteFile(invalid, []byte("clusters: {"), 0600))
+	t.Setenv(KubeConfigEnv, strings.Join([]string{first, invalid}, string(filepath.ListSeparator)))
+	_, err = LoadKubeConfigFromEnv()
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrKubeConfigNotFound)
+}
+
+const relativePathKubeConfig = `apiVersion: v1
+clusters:
+  - cluster:
+      certificate-authority: certs/ca.crt
+      server: https://127.0.0.1:6443
+    name: default
+contexts:
+  - context:
+      cluster: default
+      user: default
+    name: default
+current-context: default
+kind: Config
+users:
+  - name: default
+    user:
+      client-certificate: ~/client.crt
+      client-key: ../client.key
+`
+
+func TestKubeConfigRelativePaths(t *testing.T) {
+	fixtures := NewFixtures(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	kubeDir := filepath.Join(home, ".kube")
+	assert.Nil(t, os.MkdirAll(filepath.Join(kubeDir, "certs"), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(kubeDir, "certs", "ca.crt"), []byte(fixtures.caCert), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(home, "client.crt"), []byte(fixtures.clientCrt), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(home, "client.key"), []byte(fixtures.clientKey), 0600))
+	kubeconfigPath := filepath.Join(kubeDir, "config")
+	assert.Nil(t, os.WriteFile(kubeconfigPath, []byte(relativePathKubeConfig), 0600))
+
+	kubeconf, err := LoadKubeConfigFiles(kubeconfigPath)
+	assert.Nil(t, err)
+	assert.Equal(t, kubeconfigPath, kubeconf.Origin)
+
+	// test that relative and home paths are inlined from the right location
+	connection, err := KubeConfigToConnection(kubeconf, true)
+	assert.Nil(t, err)
+	assert.Equal(t, fixtures.caCert, connection.CAData)
+	assert.Equal(t, fixtures.clientCrt, connection.CertData)
+	assert.Equal(t, fixtures.clientKey, connection.KeyData)
+
+	// test that the resolved paths are emitted without inlining
+	connection, err = KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(kubeDir, "certs", "ca.crt"), connection.CAFile)
+	assert.Equal(t, filepath.Join(home, "client.crt"), connection.CertFile)
+	assert.Equal(t, filepath.Join(home, "client.key"), connection.KeyFile)
+
+	// test that the kubeconfig origin is used when entries have no origin of their own
+	kubeconf, err = ParseKubeConfig(relativePathKubeConfig)
+	assert.Nil(t, err)
+	kubeconf.Origin = kubeconfigPath
+	connection, err = KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(kubeDir, "certs", "ca.crt"), connection.CAFile)
+	assert.Equal(t, filepath.Join(home, "client.key"), connection.KeyFile)
+}
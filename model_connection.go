@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"time"
 
 	"arcaflow-lib-kubernetes/internal/util"
 	"go.flow.arcalot.io/pluginsdk/schema"
+	restclient "k8s.io/client-go/rest"
 )
 
 // ConnectionParameters describes how to connect to the Kubernetes API.
@@ -14,11 +16,16 @@ type ConnectionParameters struct {
 	Host    string `json:"host"`
 	APIPath string `json:"path"`
 
+	Namespace string `json:"namespace"`
+
 	Username string `json:"username"`
 	Password string `json:"password"`
 
 	ServerName string `json:"serverName"`
 
+	ProxyURL           string `json:"proxyURL"`
+	DisableCompression bool   `json:"disableCompression"`
+
 	CertData string `json:"cert"`
 	CertFile string `json:"certFile"`
 	KeyData  string `json:"key"`
@@ -29,8 +36,27 @@ type ConnectionParameters struct {
 	BearerToken     string `json:"bearerToken"`
 	BearerTokenFile string `json:"bearerTokenFile"`
 	Insecure        bool   `json:"insecure"`
+
+	PinnedSPKISHA256 *[]string `json:"pinnedSPKISHA256"`
+
+	Exec *ExecConfig `json:"exec"`
+
+	OIDC *OIDCAuthProvider `json:"oidc"`
+
+	Impersonate *ImpersonationConfig `json:"impersonate"`
+
+	Timeout   *time.Duration `json:"timeout"`
+	QPS       float32        `json:"qps"`
+	Burst     int            `json:"burst"`
+	UserAgent string         `json:"userAgent"`
 }
 
+// Defaults of the client settings. The QPS and burst defaults are the ones of client-go.
+const (
+	defaultTimeout   = 10 * time.Second
+	defaultUserAgent = "Arcaflow"
+)
+
 // UnmarshalJSON uses the Arcaflow schema system to unmarshal JSON data when called via json.Unmarshal on the
 // ConnectionParameters struct. This prevents accidentally using the wrong unmarshalling method.
 func (c *ConnectionParameters) UnmarshalJSON(data []byte) error {
@@ -40,8 +66,8 @@ func (c *ConnectionParameters) UnmarshalJSON(data []byte) error {
 }
 
 // MarshalJSON uses the Arcaflow schema system to marshal JSON data when called via json.Marshal on the
-// ConnectionParameters struct. This prevents accidentally using the wrong unmarshalling method.
-func (c *ConnectionParameters) MarshalJSON() ([]byte, error) {
+// ConnectionParameters struct. This prevents accidentally using the wrong marshalling method.
+func (c ConnectionParameters) MarshalJSON() ([]byte, error) {
 	serializedData, err := c.MarshalYAML()
 	if err != nil {
 		return nil, err
@@ -60,20 +86,21 @@ func (c *ConnectionParameters) UnmarshalYAML(unmarshaller func(interface{}) erro
 	if err := unmarshaller(&temp); err != nil {
 		return fmt.Errorf("failed to JSON unmarshal data (%w)", err)
 	}
-	unserializedData, err := connectionParametersSchema.UnserializeType(temp) //nolint:all
+	unserializedData, err := connectionParametersSchema.UnserializeType(temp)
 	if err != nil {
 		return fmt.Errorf("failed to unserialize data (%w)", err)
 	}
-	// This assignment has no effect!  We disable the linter's objection to it
-	// pending investigation.
-	// see https://github.com/arcalot/arcaflow-lib-kubernetes-go/issues/18
-	c = &unserializedData //nolint:all
+	if err := validateClientKeyPair(unserializedData); err != nil {
+		return fmt.Errorf("failed to unserialize data (%w)", err)
+	}
+	*c = unserializedData
 	return nil
 }
 
-// MarshalYAML uses the Arcaflow schema system to marshal JSON data when called via json.Marshal on the
-// ConnectionParameters struct. This prevents accidentally using the wrong unmarshalling method.
-func (c *ConnectionParameters) MarshalYAML() (any, error) {
+// MarshalYAML uses the Arcaflow schema system to marshal YAML data when called via yaml.Marshal on the
+// ConnectionParameters struct. This prevents accidentally using the wrong marshalling method. The value receiver
+// ensures that both ConnectionParameters and *ConnectionParameters are marshalled through the schema.
+func (c ConnectionParameters) MarshalYAML() (any, error) {
 	serializedData, err := connectionParametersSchema.Serialize(c)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize connection parameters (%w)", err)
@@ -88,7 +115,8 @@ var connectionParametersSchema = schema.NewTypedObject[ConnectionParameters](
 			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
 			schema.NewDisplayValue(
 				schema.PointerTo("Host"),
-				schema.PointerTo("Host name and port of the Kubernetes server"),
+				schema.PointerTo("Host name and port of the Kubernetes server, or the URL of the API server if it "+
+					"is served over plain HTTP or behind a path prefix."),
 				nil,
 			),
 			false,
@@ -112,6 +140,20 @@ var connectionParametersSchema = schema.NewTypedObject[ConnectionParameters](
 			schema.PointerTo(`"/api"`),
 			nil,
 		).TreatEmptyAsDefaultValue(),
+		"namespace": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, schema.IntPointer(63), regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)),
+			schema.NewDisplayValue(
+				schema.PointerTo("Namespace"),
+				schema.PointerTo("Default namespace for namespaced API calls."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
 		"username": schema.NewPropertySchema(
 			schema.NewStringSchema(nil, nil, nil),
 			schema.NewDisplayValue(
@@ -154,8 +196,37 @@ var connectionParametersSchema = schema.NewTypedObject[ConnectionParameters](
 			nil,
 			nil,
 		),
+		"proxyURL": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, regexp.MustCompile(`^$|^(http|https|socks5)://[^/\s]+/?$`)),
+			schema.NewDisplayValue(
+				schema.PointerTo("Proxy URL"),
+				schema.PointerTo("URL of the HTTP, HTTPS or SOCKS5 proxy to connect to the Kubernetes API through. "+
+					"If not set, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`"http://proxy.example.com:3128"`, `"socks5://127.0.0.1:1080"`},
+		).TreatEmptyAsDefaultValue(),
+		"disableCompression": schema.NewPropertySchema(
+			schema.NewBoolSchema(),
+			schema.NewDisplayValue(
+				schema.PointerTo("Disable compression"),
+				schema.PointerTo("Do not request compressed responses from the Kubernetes API."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
 		"cacert": schema.NewPropertySchema(
-			schema.NewStringSchema(nil, nil, regexp.MustCompile(`^$|^\s*-----BEGIN CERTIFICATE-----(\s*.*\s*)*-----END CERTIFICATE-----\s*$`)),
+			newPEMStringSchema(validateCertificatesPEM),
 			schema.NewDisplayValue(
 				schema.PointerTo("CA certificate"),
 				schema.PointerTo("CA certificate in PEM format to verify Kubernetes server certificate against."),
@@ -185,7 +256,7 @@ var connectionParametersSchema = schema.NewTypedObject[ConnectionParameters](
 			nil,
 		),
 		"cert": schema.NewPropertySchema(
-			schema.NewStringSchema(nil, nil, regexp.MustCompile(`^$|^\s*-----BEGIN CERTIFICATE-----(\s*.*\s*)*-----END CERTIFICATE-----\s*$`)),
+			newPEMStringSchema(validateCertificatesPEM),
 			schema.NewDisplayValue(
 				schema.PointerTo("Client certificate"),
 				schema.PointerTo("Client certificate in PEM format to authenticate against Kubernetes with."),
@@ -215,7 +286,7 @@ var connectionParametersSchema = schema.NewTypedObject[ConnectionParameters](
 			nil,
 		),
 		"key": schema.NewPropertySchema(
-			schema.NewStringSchema(nil, nil, regexp.MustCompile(`^$|^[-]+BEGIN (?:.* )?PRIVATE KEY[-]+([^-]*)[-]+END (?:.* )?PRIVATE KEY[-]+\s*$`)),
+			newPEMStringSchema(validatePrivateKeyPEM),
 			schema.NewDisplayValue(
 				schema.PointerTo("Client key"),
 				schema.PointerTo("Client private key in PEM format to authenticate against Kubernetes with."),
@@ -262,14 +333,17 @@ var connectionParametersSchema = schema.NewTypedObject[ConnectionParameters](
 			schema.NewStringSchema(nil, nil, nil),
 			schema.NewDisplayValue(
 				schema.PointerTo("Bearer token file"),
-				schema.PointerTo("File holding the bearer token to authenticate against the Kubernetes API with."),
+				schema.PointerTo("File holding the bearer token to authenticate against the Kubernetes API with. "+
+					"The file is re-read periodically and when the server rejects the token, so rotated "+
+					"service account tokens are picked up. It is only used if no other credentials, such as a bearer "+
+					"token or a client certificate, are set."),
 				nil,
 			),
 			false,
 			nil,
 			nil,
 			nil,
-			schema.PointerTo(util.JSONEncode("/var/run/secrets/kubernetes.io/serviceaccount")),
+			schema.PointerTo(util.JSONEncode(DefaultBearerTokenFile)),
 			nil,
 		),
 		"insecure": schema.NewPropertySchema(
@@ -286,6 +360,133 @@ var connectionParametersSchema = schema.NewTypedObject[ConnectionParameters](
 			nil,
 			nil,
 		),
+		"pinnedSPKISHA256": schema.NewPropertySchema(
+			schema.NewListSchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^[A-Za-z0-9+/]{43}=$`)),
+				schema.IntPointer(1),
+				nil,
+			),
+			schema.NewDisplayValue(
+				schema.PointerTo("Pinned public keys"),
+				schema.PointerTo("Base64 encoded SHA-256 hashes of the subject public key info of certificates the "+
+					"server certificate chain must contain at least one of, in addition to being issued by the CA. "+
+					"If TLS verification is skipped, only the server certificate is matched. Compute a pin with "+
+					"openssl x509 -noout -pubkey -in ca.crt | openssl pkey -pubin -outform der | "+
+					"openssl dgst -sha256 -binary | base64."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`["47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="]`},
+		),
+		"exec": schema.NewPropertySchema(
+			execConfigSchema,
+			schema.NewDisplayValue(
+				schema.PointerTo("Exec credential plugin"),
+				schema.PointerTo("Command to run to obtain credentials using the client.authentication.k8s.io "+
+					"ExecCredential protocol. The command is invoked when the first request is made and again "+
+					"whenever the returned credentials expire."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"oidc": schema.NewPropertySchema(
+			oidcAuthProviderSchema,
+			schema.NewDisplayValue(
+				schema.PointerTo("OIDC"),
+				schema.PointerTo("OpenID Connect tokens to authenticate with, as configured by the oidc auth "+
+					"provider of kubectl. The ID token is refreshed with the refresh token whenever it expires."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"impersonate": schema.NewPropertySchema(
+			impersonationConfigSchema,
+			schema.NewDisplayValue(
+				schema.PointerTo("Impersonate"),
+				schema.PointerTo("User, groups and extra information to impersonate in requests to the Kubernetes API."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"timeout": schema.NewPropertySchema(
+			schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+			schema.NewDisplayValue(
+				schema.PointerTo("Timeout"),
+				schema.PointerTo("Timeout of requests to the Kubernetes API, 10 seconds if not set. The timeout "+
+					"also bounds watches and log streams, set it to 0 to disable it or override it when building "+
+					"the client for long-running requests."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`"30s"`, `"5m"`},
+		),
+		"qps": schema.NewPropertySchema(
+			schema.NewFloatSchema(schema.PointerTo(0.0), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("QPS"),
+				schema.PointerTo("Maximum sustained number of queries per second to the Kubernetes API. 0 uses the "+
+					"client-go default."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			schema.PointerTo(util.JSONEncode(restclient.DefaultQPS)),
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"burst": schema.NewPropertySchema(
+			schema.NewIntSchema(schema.IntPointer(0), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Burst"),
+				schema.PointerTo("Maximum number of queries to the Kubernetes API in a burst above the QPS. 0 uses "+
+					"the client-go default."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			schema.PointerTo(util.JSONEncode(restclient.DefaultBurst)),
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"userAgent": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("User agent"),
+				schema.PointerTo("User agent to send to the Kubernetes API."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			schema.PointerTo(util.JSONEncode(defaultUserAgent)),
+			nil,
+		).TreatEmptyAsDefaultValue(),
 	},
 )
 
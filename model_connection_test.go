@@ -1 +1,296 @@
 package arcaflow_lib_kubernetes_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	kubernetes "arcaflow-lib-kubernetes"
+)
+
+// connectionDefaults holds the connection parameters produced by the schema when no value is provided.
+var connectionDefaults = kubernetes.ConnectionParameters{
+	Host:            "kubernetes.default.svc",
+	APIPath:         "/api",
+	CAFile:          "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+	BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+	QPS:             5,
+	Burst:           10,
+	UserAgent:       "Arcaflow",
+}
+
+type connectionPropertyTestCase struct {
+	input    map[string]any
+	expected func(c *kubernetes.ConnectionParameters)
+}
+
+func connectionPropertyTestCases(t *testing.T) map[string]connectionPropertyTestCase {
+	caCert, err := os.ReadFile("testdata/ca.crt")
+	assert.NoError(t, err)
+	clientCert, err := os.ReadFile("testdata/client.crt")
+	assert.NoError(t, err)
+	clientKey, err := os.ReadFile("testdata/client.key")
+	assert.NoError(t, err)
+
+	return map[string]connectionPropertyTestCase{
+		"host": {
+			map[string]any{"host": "127.0.0.1:6443"},
+			func(c *kubernetes.ConnectionParameters) { c.Host = "127.0.0.1:6443" },
+		},
+		"path": {
+			map[string]any{"path": "/apis"},
+			func(c *kubernetes.ConnectionParameters) { c.APIPath = "/apis" },
+		},
+		"namespace": {
+			map[string]any{"namespace": "plugins"},
+			func(c *kubernetes.ConnectionParameters) { c.Namespace = "plugins" },
+		},
+		"username": {
+			map[string]any{"username": "testuser", "password": "testpassword"},
+			func(c *kubernetes.ConnectionParameters) {
+				c.Username = "testuser"
+				c.Password = "testpassword"
+			},
+		},
+		"password": {
+			map[string]any{"username": "testuser", "password": "testpassword"},
+			func(c *kubernetes.ConnectionParameters) {
+				c.Username = "testuser"
+				c.Password = "testpassword"
+			},
+		},
+		"serverName": {
+			map[string]any{"serverName": "kubernetes.local"},
+			func(c *kubernetes.ConnectionParameters) { c.ServerName = "kubernetes.local" },
+		},
+		"cacert": {
+			map[string]any{"cacert": string(caCert)},
+			func(c *kubernetes.ConnectionParameters) { c.CAData = string(caCert) },
+		},
+		"cacertFile": {
+			map[string]any{"cacertFile": "testdata/ca.crt"},
+			func(c *kubernetes.ConnectionParameters) { c.CAFile = "testdata/ca.crt" },
+		},
+		"cert": {
+			map[string]any{"cert": string(clientCert)},
+			func(c *kubernetes.ConnectionParameters) { c.CertData = string(clientCert) },
+		},
+		"certFile": {
+			map[string]any{"certFile": "testdata/client.crt"},
+			func(c *kubernetes.ConnectionParameters) { c.CertFile = "testdata/client.crt" },
+		},
+		"key": {
+			map[string]any{"key": string(clientKey)},
+			func(c *kubernetes.ConnectionParameters) { c.KeyData = string(clientKey) },
+		},
+		"keyFile": {
+			map[string]any{"keyFile": "testdata/client.key"},
+			func(c *kubernetes.ConnectionParameters) { c.KeyFile = "testdata/client.key" },
+		},
+		"bearerToken": {
+			map[string]any{"bearerToken": "sha256~token"},
+			func(c *kubernetes.ConnectionParameters) { c.BearerToken = "sha256~token" },
+		},
+		"bearerTokenFile": {
+			map[string]any{"bearerTokenFile": "testdata/tokenfile"},
+			func(c *kubernetes.ConnectionParameters) { c.BearerTokenFile = "testdata/tokenfile" },
+		},
+		"insecure": {
+			map[string]any{"insecure": true},
+			func(c *kubernetes.ConnectionParameters) { c.Insecure = true },
+		},
+		"pinnedSPKISHA256": {
+			map[string]any{"pinnedSPKISHA256": []any{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}},
+			func(c *kubernetes.ConnectionParameters) {
+				c.PinnedSPKISHA256 = &[]string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}
+			},
+		},
+		"exec": {
+			map[string]any{"exec": map[string]any{
+				"command":            "kubectl-oidc",
+				"args":               []any{"get-token"},
+				"env":                []any{map[string]any{"name": "ISSUER", "value": "https://issuer"}},
+				"apiVersion":         "client.authentication.k8s.io/v1",
+				"interactiveMode":    "Never",
+				"provideClusterInfo": true,
+			}},
+			func(c *kubernetes.ConnectionParameters) {
+				c.Exec = &kubernetes.ExecConfig{
+					Command:            "kubectl-oidc",
+					Args:               []string{"get-token"},
+					Env:                []kubernetes.ExecEnvVar{{Name: "ISSUER", Value: "https://issuer"}},
+					APIVersion:         "client.authentication.k8s.io/v1",
+					InteractiveMode:    "Never",
+					ProvideClusterInfo: true,
+				}
+			},
+		},
+		"oidc": {
+			map[string]any{"oidc": map[string]any{
+				"idToken":                  "id-token",
+				"refreshToken":             "refresh-token",
+				"clientID":                 "kubernetes",
+				"clientSecret":             "secret",
+				"issuerURL":                "https://issuer.example.com",
+				"certificateAuthority":     "/etc/issuer/ca.crt",
+				"certificateAuthorityData": "Y2E=",
+				"extraScopes":              []any{"groups"},
+			}},
+			func(c *kubernetes.ConnectionParameters) {
+				c.OIDC = &kubernetes.OIDCAuthProvider{
+					IDToken:                  "id-token",
+					RefreshToken:             "refresh-token",
+					ClientID:                 "kubernetes",
+					ClientSecret:             "secret",
+					IssuerURL:                "https://issuer.example.com",
+					CertificateAuthority:     "/etc/issuer/ca.crt",
+					CertificateAuthorityData: "Y2E=",
+					ExtraScopes:              []string{"groups"},
+				}
+			},
+		},
+		"proxyURL": {
+			map[string]any{"proxyURL": "socks5://127.0.0.1:1080"},
+			func(c *kubernetes.ConnectionParameters) { c.ProxyURL = "socks5://127.0.0.1:1080" },
+		},
+		"disableCompression": {
+			map[string]any{"disableCompression": true},
+			func(c *kubernetes.ConnectionParameters) { c.DisableCompression = true },
+		},
+		"timeout": {
+			map[string]any{"timeout": "5m"},
+			func(c *kubernetes.ConnectionParameters) {
+				timeout := 5 * time.Minute
+				c.Timeout = &timeout
+			},
+		},
+		"timeoutDisabled": {
+			map[string]any{"timeout": 0},
+			func(c *kubernetes.ConnectionParameters) {
+				timeout := time.Duration(0)
+				c.Timeout = &timeout
+			},
+		},
+		"qps": {
+			map[string]any{"qps": 50.5},
+			func(c *kubernetes.ConnectionParameters) { c.QPS = 50.5 },
+		},
+		"burst": {
+			map[string]any{"burst": 100},
+			func(c *kubernetes.ConnectionParameters) { c.Burst = 100 },
+		},
+		"userAgent": {
+			map[string]any{"userAgent": "my-plugin/1.0"},
+			func(c *kubernetes.ConnectionParameters) { c.UserAgent = "my-plugin/1.0" },
+		},
+		"impersonate": {
+			map[string]any{"impersonate": map[string]any{
+				"user":   "system:serviceaccount:plugins:runner",
+				"uid":    "1234",
+				"groups": []any{"system:authenticated"},
+				"extra":  map[string]any{"scopes": []any{"view"}},
+			}},
+			func(c *kubernetes.ConnectionParameters) {
+				c.Impersonate = &kubernetes.ImpersonationConfig{
+					User:   "system:serviceaccount:plugins:runner",
+					UID:    "1234",
+					Groups: []string{"system:authenticated"},
+					Extra:  map[string][]string{"scopes": {"view"}},
+				}
+			},
+		},
+	}
+}
+
+func TestConnectionParametersTestCasesCoverSchema(t *testing.T) {
+	testCases := connectionPropertyTestCases(t)
+	for propertyID := range kubernetes.ConnectionParametersSchema().Properties() {
+		_, ok := testCases[propertyID]
+		assert.Truef(t, ok, "no test case for connection property %s", propertyID)
+	}
+}
+
+func TestConnectionParametersUnmarshalJSON(t *testing.T) {
+	for name, testCase := range connectionPropertyTestCases(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(testCase.input)
+			assert.NoError(t, err)
+			expected := connectionDefaults
+			testCase.expected(&expected)
+
+			var connection kubernetes.ConnectionParameters
+			assert.NoError(t, json.Unmarshal(data, &connection))
+			assert.Equal(t, expected, connection)
+		})
+	}
+}
+
+func TestConnectionParametersUnmarshalYAML(t *testing.T) {
+	for name, testCase := range connectionPropertyTestCases(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := yaml.Marshal(testCase.input)
+			assert.NoError(t, err)
+			expected := connectionDefaults
+			testCase.expected(&expected)
+
+			var connection kubernetes.ConnectionParameters
+			assert.NoError(t, yaml.Unmarshal(data, &connection))
+			assert.Equal(t, expected, connection)
+		})
+	}
+}
+
+func TestConnectionParametersRoundTrip(t *testing.T) {
+	for name, testCase := range connectionPropertyTestCases(t) {
+		t.Run(name, func(t *testing.T) {
+			expected := connectionDefaults
+			testCase.expected(&expected)
+
+			yamlData, err := yaml.Marshal(expected)
+			assert.NoError(t, err)
+			var yamlConnection kubernetes.ConnectionParameters
+			assert.NoError(t, yaml.Unmarshal(yamlData, &yamlConnection))
+			assert.Equal(t, expected, yamlConnection)
+
+			jsonData, err := json.Marshal(&expected)
+			assert.NoError(t, err)
+			var jsonConnection kubernetes.ConnectionParameters
+			assert.NoError(t, json.Unmarshal(jsonData, &jsonConnection))
+			assert.Equal(t, expected, jsonConnection)
+		})
+	}
+}
+
+func TestConnectionParametersUnmarshalEmpty(t *testing.T) {
+	var connection kubernetes.ConnectionParameters
+	assert.NoError(t, json.Unmarshal([]byte(`{}`), &connection))
+	assert.Equal(t, connectionDefaults, connection)
+}
+
+func TestConnectionParametersUnmarshalInvalid(t *testing.T) {
+	for name, input := range map[string]string{
+		"cacert":           `{"cacert": "not a certificate"}`,
+		"cert":             `{"cert": "-----BEGIN CERTIFICATE-----"}`,
+		"key":              `{"key": "not a key"}`,
+		"namespace":        `{"namespace": "Not_A_Namespace"}`,
+		"unknown-property": `{"hostname": "127.0.0.1"}`,
+		"missing-password": `{"username": "testuser"}`,
+		"exec-command":     `{"exec": {"args": ["get-token"]}}`,
+		"exec-interactive": `{"exec": {"command": "plugin", "interactiveMode": "Sometimes"}}`,
+		"oidc-client-id":   `{"oidc": {"idToken": "id-token"}}`,
+		"proxyURL":         `{"proxyURL": "ftp://proxy.example.com"}`,
+		"timeout":          `{"timeout": -1}`,
+		"impersonate-user": `{"impersonate": {"groups": ["system:authenticated"]}}`,
+		"pinnedSPKISHA256": `{"pinnedSPKISHA256": ["47DEQpj8HBSa"]}`,
+		"pinnedSPKIEmpty":  `{"pinnedSPKISHA256": []}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var connection kubernetes.ConnectionParameters
+			assert.Error(t, json.Unmarshal([]byte(input), &connection))
+		})
+	}
+}
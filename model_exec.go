@@ -0,0 +1,150 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"go.flow.arcalot.io/pluginsdk/schema"
+)
+
+// ExecConfig describes an exec credential plugin following the client.authentication.k8s.io ExecCredential
+// protocol. It is used in both kubeconfig users and connection parameters.
+type ExecConfig struct {
+	Command            string       `json:"command"`
+	Args               []string     `json:"args"`
+	Env                []ExecEnvVar `json:"env"`
+	APIVersion         string       `json:"apiVersion"`
+	InteractiveMode    string       `json:"interactiveMode"`
+	ProvideClusterInfo bool         `json:"provideClusterInfo"`
+}
+
+// ExecEnvVar is an environment variable passed to an exec credential plugin.
+type ExecEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+var execConfigSchema = schema.NewTypedObject[ExecConfig](
+	"ExecConfig",
+	map[string]*schema.PropertySchema{
+		"command": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Command"),
+				schema.PointerTo("Command to execute to obtain credentials."),
+				nil,
+			),
+			true,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`"aws"`},
+		),
+		"args": schema.NewPropertySchema(
+			schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Arguments"),
+				schema.PointerTo("Arguments to pass to the command."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`["eks", "get-token", "--cluster-name", "example"]`},
+		),
+		"env": schema.NewPropertySchema(
+			schema.NewListSchema(execEnvVarSchema, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Environment"),
+				schema.PointerTo("Additional environment variables to expose to the command."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"apiVersion": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("API version"),
+				schema.PointerTo("Version of the ExecCredential API the command speaks."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`"client.authentication.k8s.io/v1"`},
+		).TreatEmptyAsDefaultValue(),
+		"interactiveMode": schema.NewPropertySchema(
+			schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+				"Never":       schema.NewDisplayValue(schema.PointerTo("Never"), nil, nil),
+				"IfAvailable": schema.NewDisplayValue(schema.PointerTo("If available"), nil, nil),
+				"Always":      schema.NewDisplayValue(schema.PointerTo("Always"), nil, nil),
+			}),
+			schema.NewDisplayValue(
+				schema.PointerTo("Interactive mode"),
+				schema.PointerTo("Whether the command may read from standard input. Defaults to IfAvailable."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"provideClusterInfo": schema.NewPropertySchema(
+			schema.NewBoolSchema(),
+			schema.NewDisplayValue(
+				schema.PointerTo("Provide cluster info"),
+				schema.PointerTo("Pass the cluster information to the command in the KUBERNETES_EXEC_INFO variable."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
+	},
+)
+
+var execEnvVarSchema = schema.NewTypedObject[ExecEnvVar](
+	"ExecEnvVar",
+	map[string]*schema.PropertySchema{
+		"name": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Name"),
+				schema.PointerTo("Name of the environment variable."),
+				nil,
+			),
+			true,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"value": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Value"),
+				schema.PointerTo("Value of the environment variable."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+	},
+)
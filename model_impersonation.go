@@ -0,0 +1,81 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"go.flow.arcalot.io/pluginsdk/schema"
+)
+
+// ImpersonationConfig describes the user a connection acts as. The groups, UID and extra fields are only accepted
+// together with a user, as the API server rejects them otherwise.
+type ImpersonationConfig struct {
+	User   string              `json:"user"`
+	UID    string              `json:"uid"`
+	Groups []string            `json:"groups"`
+	Extra  map[string][]string `json:"extra"`
+}
+
+var impersonationConfigSchema = schema.NewTypedObject[ImpersonationConfig](
+	"ImpersonationConfig",
+	map[string]*schema.PropertySchema{
+		"user": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("User"),
+				schema.PointerTo("User to impersonate."),
+				nil,
+			),
+			true,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`"system:serviceaccount:plugins:runner"`},
+		),
+		"uid": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("UID"),
+				schema.PointerTo("UID of the impersonated user."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"groups": schema.NewPropertySchema(
+			schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), nil, nil), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Groups"),
+				schema.PointerTo("Groups of the impersonated user."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`["system:authenticated"]`},
+		),
+		"extra": schema.NewPropertySchema(
+			schema.NewMapSchema(
+				schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
+				nil,
+				nil,
+			),
+			schema.NewDisplayValue(
+				schema.PointerTo("Extra"),
+				schema.PointerTo("Extra information of the impersonated user."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+	},
+)
@@ -14,6 +14,9 @@ type KubeConfig struct {
 	Users          []KubeConfigUser    `json:"users"`
 	CurrentContext *string             `json:"current-context"`
 	Preferences    any                 `json:"preferences"`
+	// Origin is the file the kubeconfig was loaded from and is used to resolve relative file paths of entries that
+	// have no Origin of their own. It is not part of the schema.
+	Origin string `json:"-"`
 }
 
 type KubeConfigClusterParams struct {
@@ -21,12 +24,17 @@ type KubeConfigClusterParams struct {
 	CertificateAuthority     *string `json:"certificate-authority"`
 	CertificateAuthorityData *string `json:"certificate-authority-data"`
 	InsecureSkipTLSVerify    bool    `json:"insecure-skip-tls-verify"`
+	TLSServerName            *string `json:"tls-server-name"`
+	ProxyURL                 *string `json:"proxy-url"`
+	DisableCompression       bool    `json:"disable-compression"`
 	Extensions               any     `json:"extensions"`
 }
 
 type KubeConfigCluster struct {
 	Name    string                  `json:"name"`
 	Cluster KubeConfigClusterParams `json:"cluster"`
+	// Origin is the file the cluster was loaded from. It is not part of the schema.
+	Origin string `json:"-"`
 }
 
 type KubeConfigContextParameters struct {
@@ -39,21 +47,39 @@ type KubeConfigContextParameters struct {
 type KubeConfigContext struct {
 	Name    string                      `json:"name"`
 	Context KubeConfigContextParameters `json:"context"`
+	// Origin is the file the context was loaded from. It is not part of the schema.
+	Origin string `json:"-"`
 }
 
 type KubeConfigUserParameters struct {
-	Username              *string `json:"username"`
-	Password              *string `json:"password"`
-	Token                 *string `json:"token"`
-	ClientCertificate     *string `json:"client-certificate"`
-	ClientCertificateData *string `json:"client-certificate-data"`
-	ClientKey             *string `json:"client-key"`
-	ClientKeyData         *string `json:"client-key-data"`
+	Username              *string                 `json:"username"`
+	Password              *string                 `json:"password"`
+	Token                 *string                 `json:"token"`
+	TokenFile             *string                 `json:"tokenFile"`
+	ClientCertificate     *string                 `json:"client-certificate"`
+	ClientCertificateData *string                 `json:"client-certificate-data"`
+	ClientKey             *string                 `json:"client-key"`
+	ClientKeyData         *string                 `json:"client-key-data"`
+	Exec                  *ExecConfig             `json:"exec"`
+	AuthProvider          *KubeConfigAuthProvider `json:"auth-provider"`
+	As                    *string                 `json:"as"`
+	AsUID                 *string                 `json:"as-uid"`
+	AsGroups              *[]string               `json:"as-groups"`
+	AsUserExtra           *map[string][]string    `json:"as-user-extra"`
+}
+
+// KubeConfigAuthProvider is the legacy auth-provider block of a kubeconfig user. The configuration keys depend on the
+// provider, use ParseOIDCAuthProvider to read the configuration of the oidc provider.
+type KubeConfigAuthProvider struct {
+	Name   string            `json:"name"`
+	Config map[string]string `json:"config"`
 }
 
 type KubeConfigUser struct {
 	Name string                   `json:"name"`
 	User KubeConfigUserParameters `json:"user"`
+	// Origin is the file the user was loaded from. It is not part of the schema.
+	Origin string `json:"-"`
 }
 
 func (k *KubeConfig) UnmarshalJSON(data []byte) error {
@@ -63,8 +89,8 @@ func (k *KubeConfig) UnmarshalJSON(data []byte) error {
 }
 
 // MarshalJSON uses the Arcaflow schema system to marshal JSON data when called via json.Marshal on the
-// ConnectionParameters struct. This prevents accidentally using the wrong unmarshalling method.
-func (k *KubeConfig) MarshalJSON() ([]byte, error) {
+// KubeConfig struct. This prevents accidentally using the wrong marshalling method.
+func (k KubeConfig) MarshalJSON() ([]byte, error) {
 	serializedData, err := k.MarshalYAML()
 	if err != nil {
 		return nil, err
@@ -77,7 +103,7 @@ func (k *KubeConfig) MarshalJSON() ([]byte, error) {
 }
 
 // UnmarshalYAML uses the Arcaflow schema system to unmarshal YAML data when called via yaml.Unmarshal on the
-// ConnectionParameters struct. This prevents accidentally using the wrong unmarshalling method.
+// KubeConfig struct. This prevents accidentally using the wrong unmarshalling method.
 func (k *KubeConfig) UnmarshalYAML(unmarshaller func(interface{}) error) error {
 	temp := map[string]any{}
 	if err := unmarshaller(&temp); err != nil {
@@ -98,12 +124,12 @@ func (k *KubeConfig) UnmarshalYAML(unmarshaller func(interface{}) error) error {
 	return nil
 }
 
-// MarshalYAML uses the Arcaflow schema system to marshal JSON data when called via json.Marshal on the
-// ConnectionParameters struct. This prevents accidentally using the wrong unmarshalling method.
-func (k *KubeConfig) MarshalYAML() (any, error) {
-	serializedData, err := connectionParametersSchema.Serialize(k)
+// MarshalYAML uses the Arcaflow schema system to marshal YAML data when called via yaml.Marshal on the
+// KubeConfig struct. This prevents accidentally using the wrong marshalling method.
+func (k KubeConfig) MarshalYAML() (any, error) {
+	serializedData, err := kubeconfigSchema.Serialize(k)
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize connection parameters (%w)", err)
+		return nil, fmt.Errorf("failed to serialize kubeconfig (%w)", err)
 	}
 	return serializedData, nil
 }
@@ -150,7 +176,7 @@ var kubeconfigSchema = schema.NewTypedObject[KubeConfig](
 			nil,
 			nil,
 			nil,
-			schema.PointerTo(`"Config"`),
+			nil,
 			nil,
 		).TreatEmptyAsDefaultValue(),
 		"clusters": schema.NewPropertySchema(
@@ -164,7 +190,7 @@ var kubeconfigSchema = schema.NewTypedObject[KubeConfig](
 			nil,
 			nil,
 			nil,
-			schema.PointerTo(`"Clusters"`),
+			schema.PointerTo(`[]`),
 			nil,
 		),
 		"contexts": schema.NewPropertySchema(
@@ -178,7 +204,7 @@ var kubeconfigSchema = schema.NewTypedObject[KubeConfig](
 			nil,
 			nil,
 			nil,
-			schema.PointerTo(`"Contexts"`),
+			schema.PointerTo(`[]`),
 			nil,
 		),
 		"users": schema.NewPropertySchema(
@@ -192,7 +218,7 @@ var kubeconfigSchema = schema.NewTypedObject[KubeConfig](
 			nil,
 			nil,
 			nil,
-			schema.PointerTo(`"Users"`),
+			schema.PointerTo(`[]`),
 			nil,
 		),
 		"preferences": schema.NewPropertySchema(
@@ -206,7 +232,7 @@ var kubeconfigSchema = schema.NewTypedObject[KubeConfig](
 			nil,
 			nil,
 			nil,
-			schema.PointerTo(`"Preferences"`),
+			schema.PointerTo(`{}`),
 			nil,
 		),
 	},
@@ -305,6 +331,48 @@ var clusterParamsSchema = schema.NewTypedObject[KubeConfigClusterParams](
 			nil,
 			nil,
 		).TreatEmptyAsDefaultValue(),
+		"tls-server-name": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("TLSServerName"),
+				schema.PointerTo("server name to verify in the server certificate"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"proxy-url": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("ProxyURL"),
+				schema.PointerTo("URL of the proxy to connect to the cluster through"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"disable-compression": schema.NewPropertySchema(
+			schema.NewBoolSchema(),
+			schema.NewDisplayValue(
+				schema.PointerTo("DisableCompression"),
+				schema.PointerTo("disables response compression"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
 		"extensions": schema.NewPropertySchema(
 			schema.NewAnySchema(),
 			schema.NewDisplayValue(
@@ -498,6 +566,20 @@ var userParamsSchema = schema.NewTypedObject[KubeConfigUserParameters](
 			nil,
 			nil,
 		).TreatEmptyAsDefaultValue(),
+		"tokenFile": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("TokenFile"),
+				schema.PointerTo("user bearer token file path"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
 		"client-certificate": schema.NewPropertySchema(
 			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
 			schema.NewDisplayValue(
@@ -554,6 +636,129 @@ var userParamsSchema = schema.NewTypedObject[KubeConfigUserParameters](
 			nil,
 			nil,
 		).TreatEmptyAsDefaultValue(),
+		"exec": schema.NewPropertySchema(
+			execConfigSchema,
+			schema.NewDisplayValue(
+				schema.PointerTo("Exec"),
+				schema.PointerTo("exec credential plugin"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"auth-provider": schema.NewPropertySchema(
+			authProviderSchema,
+			schema.NewDisplayValue(
+				schema.PointerTo("AuthProvider"),
+				schema.PointerTo("auth provider plugin"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"as": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("As"),
+				schema.PointerTo("user to impersonate"),
+				nil,
+			),
+			false,
+			[]string{"as-uid", "as-groups", "as-user-extra"},
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"as-uid": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("AsUID"),
+				schema.PointerTo("UID to impersonate"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		).TreatEmptyAsDefaultValue(),
+		"as-groups": schema.NewPropertySchema(
+			schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), nil, nil), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("AsGroups"),
+				schema.PointerTo("groups to impersonate"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"as-user-extra": schema.NewPropertySchema(
+			schema.NewMapSchema(
+				schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
+				nil,
+				nil,
+			),
+			schema.NewDisplayValue(
+				schema.PointerTo("AsUserExtra"),
+				schema.PointerTo("extra user information to impersonate"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+	},
+)
+
+var authProviderSchema = schema.NewTypedObject[KubeConfigAuthProvider](
+	"KubeConfigAuthProvider",
+	map[string]*schema.PropertySchema{
+		"name": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Name"),
+				schema.PointerTo("auth provider name"),
+				nil,
+			),
+			true,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"config": schema.NewPropertySchema(
+			schema.NewMapSchema(schema.NewStringSchema(nil, nil, nil), schema.NewStringSchema(nil, nil, nil), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Config"),
+				schema.PointerTo("auth provider configuration"),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
 	},
 )
 
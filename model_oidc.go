@@ -0,0 +1,137 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"go.flow.arcalot.io/pluginsdk/schema"
+)
+
+// OIDCAuthProvider is the typed configuration of the oidc auth provider. It is used in connection parameters, and
+// read from and written to the auth-provider block of kubeconfig users.
+type OIDCAuthProvider struct {
+	IDToken                  string   `json:"idToken"`
+	RefreshToken             string   `json:"refreshToken"`
+	ClientID                 string   `json:"clientID"`
+	ClientSecret             string   `json:"clientSecret"`
+	IssuerURL                string   `json:"issuerURL"`
+	CertificateAuthority     string   `json:"certificateAuthority"`
+	CertificateAuthorityData string   `json:"certificateAuthorityData"`
+	ExtraScopes              []string `json:"extraScopes"`
+}
+
+var oidcAuthProviderSchema = schema.NewTypedObject[OIDCAuthProvider](
+	"OIDCAuthProvider",
+	map[string]*schema.PropertySchema{
+		"idToken": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("ID token"),
+				schema.PointerTo("ID token to authenticate against the Kubernetes API with. It is refreshed "+
+					"using the refresh token when it has expired."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"refreshToken": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Refresh token"),
+				schema.PointerTo("Refresh token to obtain a new ID token from the issuer with."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"clientID": schema.NewPropertySchema(
+			schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Client ID"),
+				schema.PointerTo("OAuth client ID registered with the issuer."),
+				nil,
+			),
+			true,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`"kubernetes"`},
+		),
+		"clientSecret": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Client secret"),
+				schema.PointerTo("OAuth client secret registered with the issuer."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"issuerURL": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Issuer URL"),
+				schema.PointerTo("URL of the OpenID Connect issuer, used to discover its token endpoint."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`"https://issuer.example.com"`},
+		),
+		"certificateAuthority": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Issuer CA certificate file"),
+				schema.PointerTo("File holding the CA certificate in PEM format to verify the issuer against."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"certificateAuthorityData": schema.NewPropertySchema(
+			schema.NewStringSchema(nil, nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Issuer CA certificate"),
+				schema.PointerTo("Base64 encoded CA certificate in PEM format to verify the issuer against."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+		),
+		"extraScopes": schema.NewPropertySchema(
+			schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), nil, nil), nil, nil),
+			schema.NewDisplayValue(
+				schema.PointerTo("Extra scopes"),
+				schema.PointerTo("Scopes to request in addition to openid when refreshing the ID token."),
+				nil,
+			),
+			false,
+			nil,
+			nil,
+			nil,
+			nil,
+			[]string{`["groups", "email"]`},
+		),
+	},
+)
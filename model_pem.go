@@ -0,0 +1,194 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"go.flow.arcalot.io/pluginsdk/schema"
+)
+
+// pemStringSchema is a string schema that validates non-empty values by parsing them, for example as PEM encoded
+// certificates. It reports itself as a plain string, so the schema remains usable in Arcaflow workflows.
+type pemStringSchema struct {
+	schema.StringSchema
+
+	parse func(data []byte) error
+}
+
+func newPEMStringSchema(parse func(data []byte) error) *pemStringSchema {
+	return &pemStringSchema{
+		StringSchema: *schema.NewStringSchema(nil, nil, nil),
+		parse:        parse,
+	}
+}
+
+func (s pemStringSchema) Unserialize(data any) (any, error) {
+	return s.UnserializeType(data)
+}
+
+func (s pemStringSchema) UnserializeType(data any) (string, error) {
+	unserialized, err := s.StringSchema.UnserializeType(data)
+	if err != nil {
+		return unserialized, err
+	}
+	return unserialized, s.ValidateType(unserialized)
+}
+
+func (s pemStringSchema) ValidateCompatibility(typeOrData any) error {
+	if data, ok := typeOrData.(string); ok {
+		_, err := s.Unserialize(data)
+		return err
+	}
+	return s.StringSchema.ValidateCompatibility(typeOrData)
+}
+
+func (s pemStringSchema) Validate(data any) error {
+	_, err := s.Serialize(data)
+	return err
+}
+
+func (s pemStringSchema) ValidateType(data string) error {
+	if err := s.StringSchema.ValidateType(data); err != nil {
+		return err
+	}
+	if data == "" {
+		return nil
+	}
+	if err := s.parse([]byte(data)); err != nil {
+		return &schema.ConstraintError{Message: err.Error()}
+	}
+	return nil
+}
+
+func (s pemStringSchema) Serialize(data any) (any, error) {
+	serialized, err := s.StringSchema.Serialize(data)
+	if err != nil {
+		return serialized, err
+	}
+	return serialized, s.ValidateType(serialized.(string))
+}
+
+func (s pemStringSchema) SerializeType(data string) (any, error) {
+	return data, s.ValidateType(data)
+}
+
+func validateCertificatesPEM(data []byte) error {
+	_, err := parseCertificatesPEM(data)
+	return err
+}
+
+func validatePrivateKeyPEM(data []byte) error {
+	_, err := parsePrivateKeyPEM(data)
+	return err
+}
+
+// parseCertificatesPEM parses one or more PEM encoded certificates. Anything but certificates and whitespace is
+// rejected.
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := bytes.TrimSpace(data); len(rest) > 0; rest = bytes.TrimSpace(rest) {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			if len(certs) == 0 {
+				return nil, errors.New("no PEM encoded certificate found")
+			}
+			return nil, fmt.Errorf("unexpected data after certificate %d", len(certs))
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("PEM block %d is a %s, expected a CERTIFICATE", len(certs)+1, block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d (%w)", len(certs)+1, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
+
+// parsePrivateKeyPEM parses a PEM encoded PKCS#1, PKCS#8 or SEC1 private key. An EC PARAMETERS block, as written by
+// openssl ecparam, may precede the key. Encrypted keys are accepted without being parsed and return a nil key.
+func parsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	var key *pem.Block
+	for rest := bytes.TrimSpace(data); len(rest) > 0; rest = bytes.TrimSpace(rest) {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		switch {
+		case block == nil && key == nil:
+			return nil, errors.New("no PEM encoded private key found")
+		case block == nil:
+			return nil, errors.New("unexpected data after the private key")
+		case block.Type == "EC PARAMETERS":
+		case key != nil:
+			return nil, fmt.Errorf("unexpected %s block after the private key", block.Type)
+		default:
+			key = block
+		}
+	}
+	if key == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	// Legacy encrypted keys carry a DEK-Info header, PKCS#8 encrypted keys have a block type of their own.
+	if _, legacyEncrypted := key.Headers["DEK-Info"]; legacyEncrypted || key.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, nil
+	}
+	switch key.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(key.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#1 private key (%w)", err)
+		}
+		return parsed, nil
+	case "EC PRIVATE KEY":
+		parsed, err := x509.ParseECPrivateKey(key.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SEC1 private key (%w)", err)
+		}
+		return parsed, nil
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(key.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#8 private key (%w)", err)
+		}
+		return parsed, nil
+	default:
+		return nil, fmt.Errorf("PEM block is a %s, expected a private key", key.Type)
+	}
+}
+
+// validateClientKeyPair checks that the inline client key belongs to the inline client certificate. Keys and
+// certificates held in files are checked when the files are loaded.
+func validateClientKeyPair(connection ConnectionParameters) error {
+	if connection.CertData == "" || connection.KeyData == "" {
+		return nil
+	}
+	certs, err := parseCertificatesPEM([]byte(connection.CertData))
+	if err != nil {
+		return fmt.Errorf("invalid client certificate (%w)", err)
+	}
+	key, err := parsePrivateKeyPEM([]byte(connection.KeyData))
+	if err != nil {
+		return fmt.Errorf("invalid client key (%w)", err)
+	}
+	if key == nil {
+		return nil
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported client key type %T", key)
+	}
+	publicKey, ok := certs[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(signer.Public()) {
+		return fmt.Errorf("the client key does not match the client certificate %s", certs[0].Subject.String())
+	}
+	return nil
+}
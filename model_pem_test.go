@@ -0,0 +1,136 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestParseCertificatesPEM(t *testing.T) {
+	caCert, err := os.ReadFile(CACERTPATH)
+	assert.Nil(t, err)
+	clientCert, err := os.ReadFile(CERTPATH)
+	assert.Nil(t, err)
+
+	certs, err := parseCertificatesPEM(caCert)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+	certs, err = parseCertificatesPEM(append(append(clientCert, '\n'), caCert...))
+	assert.Nil(t, err)
+	assert.Len(t, certs, 2)
+
+	block, _ := pem.Decode(caCert)
+	for name, input := range map[string]struct {
+		data    string
+		message string
+	}{
+		"empty":       {"  \n", "no PEM encoded certificate found"},
+		"banner-only": {"-----BEGIN CERTIFICATE-----", "no PEM encoded certificate found"},
+		"trailing":    {string(caCert) + "garbage", "unexpected data after certificate 1"},
+		"key":         {string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY"})), "PEM block 1 is a PRIVATE KEY"},
+		"truncated": {
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes[:100]})),
+			"failed to parse certificate 1",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseCertificatesPEM([]byte(input.data))
+			assert.ErrorContains(t, err, input.message)
+		})
+	}
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	assert.Nil(t, err)
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	assert.Nil(t, err)
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	ecParameters := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{6, 8, 42, 134, 72, 206, 61, 3, 1, 7}})
+
+	for name, data := range map[string][]byte{
+		"pkcs1": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		"pkcs8": pkcs8PEM,
+		"sec1":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}),
+		"sec1-with-parameters": append(
+			ecParameters,
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})...,
+		),
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, err := parsePrivateKeyPEM(data)
+			assert.Nil(t, err)
+			assert.NotNil(t, key)
+		})
+	}
+
+	for name, data := range map[string][]byte{
+		"pkcs8-encrypted": pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{0}}),
+		"legacy-encrypted": pem.EncodeToMemory(&pem.Block{
+			Type:    "RSA PRIVATE KEY",
+			Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-256-CBC,00000000000000000000000000000000"},
+			Bytes:   []byte{0},
+		}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, err := parsePrivateKeyPEM(data)
+			assert.Nil(t, err)
+			assert.Nil(t, key)
+		})
+	}
+
+	for name, input := range map[string]struct {
+		data    []byte
+		message string
+	}{
+		"empty":       {nil, "no PEM encoded private key found"},
+		"parameters":  {ecParameters, "no PEM encoded private key found"},
+		"certificate": {pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE"}), "PEM block is a CERTIFICATE"},
+		"wrong-format": {
+			pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: sec1}),
+			"failed to parse PKCS#1 private key",
+		},
+		"two-keys": {
+			append(append([]byte{}, pkcs8PEM...), pkcs8PEM...),
+			"unexpected PRIVATE KEY block after the private key",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parsePrivateKeyPEM(input.data)
+			assert.ErrorContains(t, err, input.message)
+		})
+	}
+}
+
+func TestConnectionClientKeyPair(t *testing.T) {
+	certData, keyData := newTestKeyPair(t, "first")
+	_, otherKeyData := newTestKeyPair(t, "second")
+
+	data, err := json.Marshal(map[string]any{"cert": string(certData), "key": string(keyData)})
+	assert.Nil(t, err)
+	var connection ConnectionParameters
+	assert.Nil(t, json.Unmarshal(data, &connection))
+
+	data, err = json.Marshal(map[string]any{"cert": string(certData), "key": string(otherKeyData)})
+	assert.Nil(t, err)
+	err = json.Unmarshal(data, &connection)
+	assert.ErrorContains(t, err, "the client key does not match the client certificate CN=first")
+
+	_, err = ConnectionToRestConfig(ConnectionParameters{
+		Host:     "127.0.0.1:6443",
+		CertData: string(certData),
+		KeyData:  string(otherKeyData),
+	})
+	assert.ErrorContains(t, err, "the client key does not match")
+}
@@ -0,0 +1,102 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"k8s.io/client-go/kubernetes"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// NamespacedClientset is a Kubernetes clientset that defaults namespaced calls to the namespace of the connection.
+// All methods of kubernetes.Interface remain available for calls that need a different namespace.
+type NamespacedClientset struct {
+	kubernetes.Interface
+	namespace string
+}
+
+// NamespacedClient creates a clientset for the connection whose namespaced helpers use the namespace of the
+// connection, or "default" if the connection has no namespace set.
+func NamespacedClient(connection ConnectionParameters) (*NamespacedClientset, error) {
+	clientSet, err := Client(connection)
+	if err != nil {
+		return nil, err
+	}
+	return NewNamespacedClientset(clientSet, connection.Namespace), nil
+}
+
+// NewNamespacedClientset wraps an existing clientset, for example a fake clientset in tests. An empty namespace
+// selects the "default" namespace.
+func NewNamespacedClientset(clientSet kubernetes.Interface, namespace string) *NamespacedClientset {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return &NamespacedClientset{
+		Interface: clientSet,
+		namespace: namespace,
+	}
+}
+
+// Namespace returns the namespace the helpers operate in.
+func (c *NamespacedClientset) Namespace() string {
+	return c.namespace
+}
+
+// Pods returns the pod client for the namespace.
+func (c *NamespacedClientset) Pods() typedcorev1.PodInterface {
+	return c.CoreV1().Pods(c.namespace)
+}
+
+// ConfigMaps returns the config map client for the namespace.
+func (c *NamespacedClientset) ConfigMaps() typedcorev1.ConfigMapInterface {
+	return c.CoreV1().ConfigMaps(c.namespace)
+}
+
+// Secrets returns the secret client for the namespace.
+func (c *NamespacedClientset) Secrets() typedcorev1.SecretInterface {
+	return c.CoreV1().Secrets(c.namespace)
+}
+
+// Services returns the service client for the namespace.
+func (c *NamespacedClientset) Services() typedcorev1.ServiceInterface {
+	return c.CoreV1().Services(c.namespace)
+}
+
+// ServiceAccounts returns the service account client for the namespace.
+func (c *NamespacedClientset) ServiceAccounts() typedcorev1.ServiceAccountInterface {
+	return c.CoreV1().ServiceAccounts(c.namespace)
+}
+
+// PersistentVolumeClaims returns the persistent volume claim client for the namespace.
+func (c *NamespacedClientset) PersistentVolumeClaims() typedcorev1.PersistentVolumeClaimInterface {
+	return c.CoreV1().PersistentVolumeClaims(c.namespace)
+}
+
+// Events returns the event client for the namespace.
+func (c *NamespacedClientset) Events() typedcorev1.EventInterface {
+	return c.CoreV1().Events(c.namespace)
+}
+
+// Deployments returns the deployment client for the namespace.
+func (c *NamespacedClientset) Deployments() typedappsv1.DeploymentInterface {
+	return c.AppsV1().Deployments(c.namespace)
+}
+
+// StatefulSets returns the stateful set client for the namespace.
+func (c *NamespacedClientset) StatefulSets() typedappsv1.StatefulSetInterface {
+	return c.AppsV1().StatefulSets(c.namespace)
+}
+
+// DaemonSets returns the daemon set client for the namespace.
+func (c *NamespacedClientset) DaemonSets() typedappsv1.DaemonSetInterface {
+	return c.AppsV1().DaemonSets(c.namespace)
+}
+
+// Jobs returns the job client for the namespace.
+func (c *NamespacedClientset) Jobs() typedbatchv1.JobInterface {
+	return c.BatchV1().Jobs(c.namespace)
+}
+
+// CronJobs returns the cron job client for the namespace.
+func (c *NamespacedClientset) CronJobs() typedbatchv1.CronJobInterface {
+	return c.BatchV1().CronJobs(c.namespace)
+}
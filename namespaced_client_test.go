@@ -0,0 +1,50 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNamespacedClientset(t *testing.T) {
+	clientSet := NewNamespacedClientset(fake.NewSimpleClientset(), "plugins")
+	assert.Equal(t, "plugins", clientSet.Namespace())
+
+	_, err := clientSet.Pods().Create(context.Background(), &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+	}, metav1.CreateOptions{})
+	assert.Nil(t, err)
+	pod, err := clientSet.CoreV1().Pods("plugins").Get(context.Background(), "test", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "plugins", pod.Namespace)
+	_, err = clientSet.CoreV1().Pods("default").Get(context.Background(), "test", metav1.GetOptions{})
+	assert.NotNil(t, err)
+
+	// test the default namespace
+	assert.Equal(t, "default", NewNamespacedClientset(fake.NewSimpleClientset(), "").Namespace())
+}
+
+func TestNamespacedClient(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind": "ConfigMapList", "apiVersion": "v1", "items": []}`))
+	}))
+	t.Cleanup(server.Close)
+
+	clientSet, err := NamespacedClient(ConnectionParameters{
+		Host:      strings.TrimPrefix(server.URL, "http://"),
+		Namespace: "plugins",
+	})
+	assert.Nil(t, err)
+	_, err = clientSet.ConfigMaps().List(context.Background(), metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/api/v1/namespaces/plugins/configmaps"}, paths)
+}
@@ -0,0 +1,431 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCAuthProviderName is the name of the oidc auth provider in kubeconfig files.
+const OIDCAuthProviderName = "oidc"
+
+const (
+	oidcIDToken                  = "id-token"
+	oidcRefreshToken             = "refresh-token"
+	oidcClientID                 = "client-id"
+	oidcClientSecret             = "client-secret"
+	oidcIssuerURL                = "idp-issuer-url"
+	oidcCertificateAuthority     = "idp-certificate-authority"
+	oidcCertificateAuthorityData = "idp-certificate-authority-data"
+	oidcExtraScopes              = "extra-scopes"
+)
+
+// oidcExpiryDelta is subtracted from the expiry of the ID token so that a token about to expire is refreshed before
+// it is sent to the API server.
+const oidcExpiryDelta = 10 * time.Second
+
+// oidcRequestTimeout bounds the discovery and token requests against the identity provider.
+const oidcRequestTimeout = 30 * time.Second
+
+// ParseOIDCAuthProvider reads the configuration of an auth-provider block named oidc.
+func ParseOIDCAuthProvider(provider KubeConfigAuthProvider) (OIDCAuthProvider, error) {
+	if provider.Name != OIDCAuthProviderName {
+		return OIDCAuthProvider{}, fmt.Errorf("auth provider %s is not an oidc auth provider", provider.Name)
+	}
+	cfg := provider.Config
+	result := OIDCAuthProvider{
+		IDToken:                  cfg[oidcIDToken],
+		RefreshToken:             cfg[oidcRefreshToken],
+		ClientID:                 cfg[oidcClientID],
+		ClientSecret:             cfg[oidcClientSecret],
+		IssuerURL:                cfg[oidcIssuerURL],
+		CertificateAuthority:     cfg[oidcCertificateAuthority],
+		CertificateAuthorityData: cfg[oidcCertificateAuthorityData],
+	}
+	if scopes := cfg[oidcExtraScopes]; scopes != "" {
+		result.ExtraScopes = strings.Split(scopes, ",")
+	}
+	return result, nil
+}
+
+// AuthProvider converts the configuration back into a kubeconfig auth-provider block. Empty values are omitted.
+func (o OIDCAuthProvider) AuthProvider() KubeConfigAuthProvider {
+	cfg := map[string]string{}
+	for key, value := range map[string]string{
+		oidcIDToken:                  o.IDToken,
+		oidcRefreshToken:             o.RefreshToken,
+		oidcClientID:                 o.ClientID,
+		oidcClientSecret:             o.ClientSecret,
+		oidcIssuerURL:                o.IssuerURL,
+		oidcCertificateAuthority:     o.CertificateAuthority,
+		oidcCertificateAuthorityData: o.CertificateAuthorityData,
+		oidcExtraScopes:              strings.Join(o.ExtraScopes, ","),
+	} {
+		if value != "" {
+			cfg[key] = value
+		}
+	}
+	return KubeConfigAuthProvider{
+		Name:   OIDCAuthProviderName,
+		Config: cfg,
+	}
+}
+
+// IDTokenValid returns true if the ID token is set and does not expire within the next few seconds. The token
+// signature is not verified, that is up to the API server.
+func (o OIDCAuthProvider) IDTokenValid(now time.Time) (bool, error) {
+	if o.IDToken == "" {
+		return false, nil
+	}
+	parts := strings.Split(o.IDToken, ".")
+	if len(parts) != 3 {
+		return false, errors.New("the oidc id-token is not a valid JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false, fmt.Errorf("failed to decode the oidc id-token payload (%w)", err)
+	}
+	var claims struct {
+		Expiry json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return false, fmt.Errorf("failed to parse the oidc id-token claims (%w)", err)
+	}
+	expiry, err := claims.Expiry.Float64()
+	if err != nil {
+		return false, fmt.Errorf("invalid oidc id-token expiry (%w)", err)
+	}
+	return now.Add(oidcExpiryDelta).Before(time.Unix(int64(expiry), 0)), nil
+}
+
+// Refresh obtains a new ID token from the issuer using the refresh token, requesting the extra scopes along with the
+// openid scope. The token endpoint is looked up through OpenID Connect discovery. If the issuer rotates the refresh
+// token, the returned configuration holds the new one, and the old refresh token must not be used again. Relative
+// idp-certificate-authority paths are resolved against origin.
+func (o OIDCAuthProvider) Refresh(origin string) (OIDCAuthProvider, error) {
+	if o.RefreshToken == "" {
+		return OIDCAuthProvider{}, errors.New("no valid oidc id-token, and cannot refresh without refresh-token")
+	}
+	if o.IssuerURL == "" {
+		return OIDCAuthProvider{}, errors.New("no valid oidc id-token, and cannot refresh without idp-issuer-url")
+	}
+	client, err := o.httpClient(origin)
+	if err != nil {
+		return OIDCAuthProvider{}, err
+	}
+	tokenURL, err := oidcTokenEndpoint(client, o.IssuerURL)
+	if err != nil {
+		return OIDCAuthProvider{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", o.RefreshToken)
+	form.Set("client_id", o.ClientID)
+	if o.ClientSecret != "" {
+		form.Set("client_secret", o.ClientSecret)
+	}
+	if len(o.ExtraScopes) > 0 {
+		form.Set("scope", strings.Join(append([]string{"openid"}, o.ExtraScopes...), " "))
+	}
+	response, err := client.PostForm(tokenURL, form)
+	if err != nil {
+		return OIDCAuthProvider{}, fmt.Errorf("failed to refresh oidc token (%w)", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return OIDCAuthProvider{}, fmt.Errorf("failed to read oidc token response (%w)", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return OIDCAuthProvider{}, fmt.Errorf("failed to refresh oidc token: %s", response.Status)
+	}
+	var token struct {
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return OIDCAuthProvider{}, fmt.Errorf("failed to decode oidc token response (%w)", err)
+	}
+	if token.IDToken == "" {
+		return OIDCAuthProvider{}, errors.New("the oidc token response did not contain an id_token")
+	}
+
+	refreshed := o
+	refreshed.IDToken = token.IDToken
+	if token.RefreshToken != "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	return refreshed, nil
+}
+
+func (o OIDCAuthProvider) httpClient(origin string) (*http.Client, error) {
+	var caData []byte
+	switch {
+	case o.CertificateAuthorityData != "":
+		data, err := base64.StdEncoding.DecodeString(o.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s (%w)", oidcCertificateAuthorityData, err)
+		}
+		caData = data
+	case o.CertificateAuthority != "":
+		caFile, err := resolveKubeConfigPath(o.CertificateAuthority, origin)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, &CredentialFileError{Path: caFile, Err: err}
+		}
+		caData = data
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caData != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, errors.New("no certificates found in the oidc idp certificate authority")
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   oidcRequestTimeout,
+	}, nil
+}
+
+func oidcTokenEndpoint(client *http.Client, issuer string) (string, error) {
+	response, err := client.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", fmt.Errorf("failed to query oidc discovery endpoint (%w)", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to query oidc discovery endpoint: %s", response.Status)
+	}
+	var metadata struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&metadata); err != nil {
+		return "", fmt.Errorf("failed to decode oidc discovery document (%w)", err)
+	}
+	if metadata.TokenEndpoint == "" {
+		return "", errors.New("the oidc discovery document does not contain a token_endpoint")
+	}
+	return metadata.TokenEndpoint, nil
+}
+
+// oidcUserAuthProvider reads the oidc auth provider of the user for a connection and checks that it yields a valid ID
+// token, refreshing it if it has expired. Relative paths are resolved, as the connection has no origin to resolve them
+// against. If persist is set, refreshed tokens are written back to the kubeconfig file the user was loaded from.
+func oidcUserAuthProvider(user *KubeConfigUser, persist bool) (*OIDCAuthProvider, error) {
+	provider, err := ParseOIDCAuthProvider(*user.User.AuthProvider)
+	if err != nil {
+		return nil, err
+	}
+	if provider.CertificateAuthority != "" {
+		caFile, err := resolveKubeConfigPath(provider.CertificateAuthority, user.Origin)
+		if err != nil {
+			return nil, err
+		}
+		provider.CertificateAuthority = caFile
+	}
+	source := oidcTokenSourceFor(provider)
+	if persist {
+		if err := source.persistTo(user.Origin, user.Name); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := source.token(); err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// oidcTokenSourceKey identifies the token source of an oidc auth provider by the refresh token it started with.
+type oidcTokenSourceKey struct {
+	issuerURL    string
+	clientID     string
+	refreshToken string
+}
+
+// oidcTokenSources holds the token sources of the oidc auth providers seen by the process. All clients and
+// conversions of the same auth provider share one token source, so a refresh token rotated by one of them is never
+// sent again by another.
+var oidcTokenSources = struct {
+	lock    sync.Mutex
+	sources map[oidcTokenSourceKey]*oidcTokenSource
+}{sources: map[oidcTokenSourceKey]*oidcTokenSource{}}
+
+// oidcTokenSourceFor returns the shared token source of the auth provider. Auth providers without a refresh token
+// cannot be refreshed, so they get a token source of their own.
+func oidcTokenSourceFor(provider OIDCAuthProvider) *oidcTokenSource {
+	if provider.RefreshToken == "" {
+		return &oidcTokenSource{provider: provider}
+	}
+	key := oidcTokenSourceKey{
+		issuerURL:    provider.IssuerURL,
+		clientID:     provider.ClientID,
+		refreshToken: provider.RefreshToken,
+	}
+	oidcTokenSources.lock.Lock()
+	defer oidcTokenSources.lock.Unlock()
+	source, ok := oidcTokenSources.sources[key]
+	if !ok {
+		source = &oidcTokenSource{provider: provider}
+		oidcTokenSources.sources[key] = source
+	}
+	return source
+}
+
+// currentOIDCAuthProvider returns the auth provider with the latest tokens obtained for it.
+func currentOIDCAuthProvider(provider OIDCAuthProvider) OIDCAuthProvider {
+	source := oidcTokenSourceFor(provider)
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	return source.provider
+}
+
+// oidcTokenSource hands out the ID token of an oidc auth provider and refreshes it when it has expired.
+type oidcTokenSource struct {
+	lock      sync.Mutex
+	provider  OIDCAuthProvider
+	refreshed bool
+	// persistPath and persistUser name the kubeconfig file and user refreshed tokens are written back to, if set.
+	persistPath string
+	persistUser string
+}
+
+// persistTo writes refreshed tokens back to the user in the kubeconfig file from now on. Tokens refreshed before are
+// written right away.
+func (s *oidcTokenSource) persistTo(path string, userName string) error {
+	if path == "" {
+		return errors.New("cannot persist the refreshed oidc token: the kubeconfig was not loaded from a file")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.persistPath = path
+	s.persistUser = userName
+	if s.refreshed {
+		return persistOIDCAuthProvider(s.persistPath, s.persistUser, s.provider)
+	}
+	return nil
+}
+
+// token returns a valid ID token, refreshing it if it has expired.
+func (s *oidcTokenSource) token() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	valid, err := s.provider.IDTokenValid(time.Now())
+	if err != nil {
+		return "", err
+	}
+	if valid {
+		return s.provider.IDToken, nil
+	}
+	refreshed, err := s.provider.Refresh("")
+	if err != nil {
+		return "", err
+	}
+	s.provider = refreshed
+	s.refreshed = true
+	if s.persistPath != "" {
+		if err := persistOIDCAuthProvider(s.persistPath, s.persistUser, refreshed); err != nil {
+			return "", err
+		}
+	}
+	return refreshed.IDToken, nil
+}
+
+// oidcRoundTripper authenticates requests with the ID token of the oidc auth provider. The token is refreshed when
+// it expires, so long-lived clients keep working.
+type oidcRoundTripper struct {
+	source *oidcTokenSource
+	rt     http.RoundTripper
+}
+
+func newOIDCRoundTripper(provider OIDCAuthProvider) func(http.RoundTripper) http.RoundTripper {
+	source := oidcTokenSourceFor(provider)
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &oidcRoundTripper{source: source, rt: rt}
+	}
+}
+
+func (o *oidcRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := o.source.token()
+	if err != nil {
+		return nil, err
+	}
+	authenticated := req.Clone(req.Context())
+	authenticated.Header.Set("Authorization", "Bearer "+token)
+	return o.rt.RoundTrip(authenticated)
+}
+
+// persistOIDCAuthProvider replaces the tokens in the auth-provider configuration of the named user in the kubeconfig
+// file. The rest of the configuration is left as it is. The file is replaced atomically and keeps its permissions.
+func persistOIDCAuthProvider(path string, userName string, provider OIDCAuthProvider) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot persist the refreshed oidc token (%w)", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot persist the refreshed oidc token (%w)", err)
+	}
+	kubeconfig, err := ParseKubeConfig(string(data))
+	if err != nil {
+		return fmt.Errorf("cannot persist the refreshed oidc token to %s (%w)", path, err)
+	}
+	user := findKubeConfigUser(kubeconfig, userName)
+	if user == nil {
+		return fmt.Errorf("cannot persist the refreshed oidc token (%w)", &UserNotFoundError{Name: userName})
+	}
+	if user.User.AuthProvider == nil || user.User.AuthProvider.Name != OIDCAuthProviderName {
+		return fmt.Errorf("cannot persist the refreshed oidc token: user %s has no oidc auth provider", userName)
+	}
+	if user.User.AuthProvider.Config == nil {
+		user.User.AuthProvider.Config = map[string]string{}
+	}
+	user.User.AuthProvider.Config[oidcIDToken] = provider.IDToken
+	user.User.AuthProvider.Config[oidcRefreshToken] = provider.RefreshToken
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot persist the refreshed oidc token (%w)", err)
+	}
+	defer func() {
+		_ = os.Remove(tempFile.Name())
+	}()
+	if err := WriteKubeConfig(tempFile, kubeconfig); err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+	if err := tempFile.Chmod(stat.Mode().Perm()); err != nil {
+		_ = tempFile.Close()
+		return fmt.Errorf("cannot persist the refreshed oidc token (%w)", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("cannot persist the refreshed oidc token (%w)", err)
+	}
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return fmt.Errorf("cannot persist the refreshed oidc token (%w)", err)
+	}
+	return nil
+}
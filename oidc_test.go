@@ -0,0 +1,263 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestIDToken creates an unsigned JWT expiring at the given time.
+func newTestIDToken(t *testing.T, subject string, expiry time.Time) string {
+	payload, err := json.Marshal(map[string]any{"sub": subject, "exp": expiry.Unix()})
+	assert.Nil(t, err)
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+// testOIDCIssuer is an OIDC issuer that exchanges the current refresh token for a new ID token and rotates the
+// refresh token on every refresh, rejecting the old one.
+type testOIDCIssuer struct {
+	server        *httptest.Server
+	lock          sync.Mutex
+	refreshToken  string
+	idToken       string
+	tokenLifetime time.Duration
+	scope         string
+	refreshes     int
+}
+
+func newTestOIDCIssuer(t *testing.T, tokenLifetime time.Duration) *testOIDCIssuer {
+	issuer := &testOIDCIssuer{refreshToken: "old-refresh", tokenLifetime: tokenLifetime}
+	mux := http.NewServeMux()
+	issuer.server = httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"issuer": %q, "token_endpoint": %q}`, issuer.server.URL, issuer.server.URL+"/token")
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		issuer.lock.Lock()
+		defer issuer.lock.Unlock()
+		if r.PostFormValue("grant_type") != "refresh_token" ||
+			r.PostFormValue("refresh_token") != issuer.refreshToken ||
+			r.PostFormValue("client_id") != "kubernetes" ||
+			r.PostFormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		issuer.refreshes++
+		issuer.scope = r.PostFormValue("scope")
+		issuer.refreshToken = fmt.Sprintf("refresh-%d", issuer.refreshes)
+		issuer.idToken = newTestIDToken(t, fmt.Sprintf("refreshed-%d", issuer.refreshes), time.Now().Add(tokenLifetime))
+		_, _ = fmt.Fprintf(
+			w,
+			`{"id_token": %q, "refresh_token": %q, "token_type": "Bearer"}`,
+			issuer.idToken,
+			issuer.refreshToken,
+		)
+	})
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// state returns the number of refreshes and the last issued ID token.
+func (i *testOIDCIssuer) state() (int, string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.refreshes, i.idToken
+}
+
+func newOIDCKubeConfig(issuer string, idToken string) string {
+	return fmt.Sprintf(`apiVersion: v1
+clusters:
+  - cluster:
+      server: https://127.0.0.1:6443
+    name: default
+contexts:
+  - context:
+      cluster: default
+      user: oidc
+    name: default
+current-context: default
+kind: Config
+users:
+  - name: oidc
+    user:
+      auth-provider:
+        name: oidc
+        config:
+          client-id: kubernetes
+          client-secret: secret
+          id-token: %s
+          idp-issuer-url: %s
+          refresh-token: old-refresh
+`, idToken, issuer)
+}
+
+func TestParseOIDCAuthProvider(t *testing.T) {
+	kubeconf, err := ParseKubeConfig(newOIDCKubeConfig("https://issuer.example.com", "token"))
+	assert.Nil(t, err)
+	kubeconf.Users[0].User.AuthProvider.Config["extra-scopes"] = "groups,email"
+	provider, err := ParseOIDCAuthProvider(*kubeconf.Users[0].User.AuthProvider)
+	assert.Nil(t, err)
+	assert.Equal(t, OIDCAuthProvider{
+		IDToken:      "token",
+		RefreshToken: "old-refresh",
+		ClientID:     "kubernetes",
+		ClientSecret: "secret",
+		IssuerURL:    "https://issuer.example.com",
+		ExtraScopes:  []string{"groups", "email"},
+	}, provider)
+	assert.Equal(t, *kubeconf.Users[0].User.AuthProvider, provider.AuthProvider())
+
+	_, err = ParseOIDCAuthProvider(KubeConfigAuthProvider{Name: "gcp"})
+	assert.NotNil(t, err)
+}
+
+func TestOIDCValidToken(t *testing.T) {
+	validToken := newTestIDToken(t, "valid", time.Now().Add(time.Hour))
+	issuer := newTestOIDCIssuer(t, time.Hour)
+	kubeconf, err := ParseKubeConfig(newOIDCKubeConfig(issuer.server.URL, validToken))
+	assert.Nil(t, err)
+
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, validToken, connection.OIDC.IDToken)
+	assert.Empty(t, connection.BearerToken)
+	refreshes, _ := issuer.state()
+	assert.Equal(t, 0, refreshes)
+
+	// test that the auth provider survives the conversion back to a kubeconfig
+	kubeconfBack, err := ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, kubeconf.Users[0].User.AuthProvider, kubeconfBack.Users[0].User.AuthProvider)
+}
+
+func TestOIDCRefresh(t *testing.T) {
+	expiredToken := newTestIDToken(t, "expired", time.Now().Add(-time.Hour))
+	issuer := newTestOIDCIssuer(t, time.Hour)
+	kubeconfigPath := filepath.Join(t.TempDir(), "config")
+	assert.Nil(t, os.WriteFile(kubeconfigPath, []byte(newOIDCKubeConfig(issuer.server.URL, expiredToken)), 0600))
+	kubeconf, err := LoadKubeConfigFiles(kubeconfigPath)
+	assert.Nil(t, err)
+	kubeconf.Users[0].User.AuthProvider.Config["extra-scopes"] = "groups,email"
+
+	// test that an expired token is refreshed without touching the file, requesting the extra scopes
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	refreshes, refreshedToken := issuer.state()
+	assert.Equal(t, 1, refreshes)
+	issuer.lock.Lock()
+	assert.Equal(t, "openid groups email", issuer.scope)
+	issuer.lock.Unlock()
+	unchanged, err := LoadKubeConfigFiles(kubeconfigPath)
+	assert.Nil(t, err)
+	assert.Equal(t, expiredToken, unchanged.Users[0].User.AuthProvider.Config["id-token"])
+
+	// test that the rotated refresh token replaces the revoked one in later conversions and kubeconfigs
+	connection, err = KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	refreshes, _ = issuer.state()
+	assert.Equal(t, 1, refreshes)
+	kubeconfBack, err := ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, refreshedToken, kubeconfBack.Users[0].User.AuthProvider.Config["id-token"])
+	assert.Equal(t, "refresh-1", kubeconfBack.Users[0].User.AuthProvider.Config["refresh-token"])
+
+	// test that the refreshed tokens are written back when requested
+	connection, _, err = KubeConfigToConnectionForContext(kubeconf, "", KubeConfigConnectionOptions{
+		PersistOIDCTokens: true,
+	})
+	assert.Nil(t, err)
+	refreshes, _ = issuer.state()
+	assert.Equal(t, 1, refreshes)
+	persisted, err := LoadKubeConfigFiles(kubeconfigPath)
+	assert.Nil(t, err)
+	assert.Equal(t, refreshedToken, persisted.Users[0].User.AuthProvider.Config["id-token"])
+	assert.Equal(t, "refresh-1", persisted.Users[0].User.AuthProvider.Config["refresh-token"])
+	assert.Equal(t, "secret", persisted.Users[0].User.AuthProvider.Config["client-secret"])
+	stat, err := os.Stat(kubeconfigPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	// test that the persisted token is used without refreshing
+	connection, err = KubeConfigToConnection(persisted, false)
+	assert.Nil(t, err)
+	assert.Equal(t, refreshedToken, connection.OIDC.IDToken)
+	refreshes, _ = issuer.state()
+	assert.Equal(t, 1, refreshes)
+}
+
+func TestOIDCClientRefresh(t *testing.T) {
+	// The issued ID tokens expire right away, so every request needs a refresh.
+	issuer := newTestOIDCIssuer(t, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, idToken := issuer.state()
+		if r.Header.Get("Authorization") != "Bearer "+idToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	t.Cleanup(server.Close)
+	kubeconf, err := ParseKubeConfig(newOIDCKubeConfig(
+		issuer.server.URL,
+		newTestIDToken(t, "expired", time.Now().Add(-time.Hour)),
+	))
+	assert.Nil(t, err)
+	kubeconf.Clusters[0].Cluster.Server = server.URL
+
+	// test that a long-lived client refreshes the expired token before every request with the rotated refresh token
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	client, err := Client(connection)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = client.Discovery().ServerVersion()
+		assert.Nil(t, err)
+	}
+	refreshes, _ := issuer.state()
+	assert.Equal(t, 4, refreshes)
+
+	// test that a second client of the same connection does not reuse the revoked refresh token
+	client, err = Client(connection)
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+	refreshes, _ = issuer.state()
+	assert.Equal(t, 5, refreshes)
+}
+
+func TestOIDCRefreshFailure(t *testing.T) {
+	expiredToken := newTestIDToken(t, "expired", time.Now().Add(-time.Hour))
+	issuer := newTestOIDCIssuer(t, time.Hour)
+	kubeconf, err := ParseKubeConfig(newOIDCKubeConfig(issuer.server.URL, expiredToken))
+	assert.Nil(t, err)
+
+	// test failure on a rejected refresh token
+	kubeconf.Users[0].User.AuthProvider.Config["refresh-token"] = "revoked"
+	_, err = KubeConfigToConnection(kubeconf, false)
+	assert.NotNil(t, err)
+
+	// test failure without a refresh token
+	delete(kubeconf.Users[0].User.AuthProvider.Config, "refresh-token")
+	_, err = KubeConfigToConnection(kubeconf, false)
+	assert.NotNil(t, err)
+
+	// test failure when persisting a kubeconfig that was not loaded from a file
+	kubeconf.Users[0].User.AuthProvider.Config["refresh-token"] = "old-refresh"
+	_, _, err = KubeConfigToConnectionForContext(kubeconf, "", KubeConfigConnectionOptions{PersistOIDCTokens: true})
+	assert.NotNil(t, err)
+
+	// test failure on unsupported auth providers
+	kubeconf.Users[0].User.AuthProvider.Name = "gcp"
+	_, err = KubeConfigToConnection(kubeconf, false)
+	assert.NotNil(t, err)
+}
@@ -6,13 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"io"
 	core "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	restclient "k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
-	"time"
 )
 
 func ParseKubeConfig(data string) (KubeConfig, error) {
@@ -23,82 +28,270 @@ func ParseKubeConfig(data string) (KubeConfig, error) {
 	return kubeconfig, nil
 }
 
+// WriteKubeConfig serializes the kubeconfig through the kubeconfig schema and writes it to the writer as YAML. Unset
+// optional fields are omitted and keys are sorted, so writing the same kubeconfig always produces the same bytes.
+func WriteKubeConfig(writer io.Writer, kubeconfig KubeConfig) error {
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(kubeconfig); err != nil {
+		return fmt.Errorf("failed to write kubeconfig (%w)", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to write kubeconfig (%w)", err)
+	}
+	return nil
+}
+
+// KubeConfigConnectionOptions holds the options for KubeConfigToConnectionForContext. The Cluster, User and Namespace
+// fields mirror the kubectl --cluster, --user and --namespace flags and override the values of the selected context.
+type KubeConfigConnectionOptions struct {
+	// InlineFiles reads the referenced certificate and key files into the connection instead of referencing them.
+	InlineFiles bool
+	// Cluster overrides the cluster of the selected context.
+	Cluster string
+	// User overrides the user of the selected context.
+	User string
+	// Namespace overrides the namespace of the selected context.
+	Namespace string
+	// PersistOIDCTokens writes the tokens of the oidc auth provider back to the kubeconfig file the user was loaded
+	// from whenever they are refreshed, during the conversion or later by clients of the connection, so later
+	// invocations don't have to refresh them again and don't send a rotated refresh token.
+	PersistOIDCTokens bool
+}
+
 func KubeConfigToConnection(kubeconfig KubeConfig, inlineFiles bool) (ConnectionParameters, error) {
 	if kubeconfig.CurrentContext == nil {
-		return ConnectionParameters{}, errors.New("unusable KubeConfig: no current context is set")
+		return ConnectionParameters{}, ErrNoCurrentContext
+	}
+	connectionParams, _, err := KubeConfigToConnectionForContext(
+		kubeconfig,
+		*kubeconfig.CurrentContext,
+		KubeConfigConnectionOptions{InlineFiles: inlineFiles},
+	)
+	return connectionParams, err
+}
+
+// KubeConfigToConnectionForContext converts the named context of the kubeconfig into connection parameters, applying
+// the overrides in opts the same way kubectl applies --context, --cluster, --user and --namespace. An empty context
+// name selects the current context. It is not an error to have neither a context name nor a current context as long
+// as both the cluster and the user are passed as overrides. The returned string is the resolved namespace.
+func KubeConfigToConnectionForContext(
+	kubeconfig KubeConfig,
+	contextName string,
+	opts KubeConfigConnectionOptions,
+) (ConnectionParameters, string, error) {
+	if contextName == "" && kubeconfig.CurrentContext != nil {
+		contextName = *kubeconfig.CurrentContext
 	}
-	var context *KubeConfigContext
-	for _, ctx := range kubeconfig.Contexts {
-		if ctx.Name == *kubeconfig.CurrentContext {
-			ctxLocal := ctx
-			context = &ctxLocal
+	contextParams := KubeConfigContextParameters{}
+	if contextName != "" {
+		context := findKubeConfigContext(kubeconfig, contextName)
+		if context == nil {
+			return ConnectionParameters{}, "", &ContextNotFoundError{Name: contextName}
 		}
+		contextParams = context.Context
+	} else if opts.Cluster == "" || opts.User == "" {
+		return ConnectionParameters{}, "", ErrNoCurrentContext
+	}
+	if opts.Cluster != "" {
+		contextParams.Cluster = opts.Cluster
+	}
+	if opts.User != "" {
+		contextParams.User = opts.User
+	}
+	if opts.Namespace != "" {
+		contextParams.Namespace = opts.Namespace
+	}
+
+	cluster := findKubeConfigCluster(kubeconfig, contextParams.Cluster)
+	if cluster == nil {
+		return ConnectionParameters{}, "", &ClusterNotFoundError{Name: contextParams.Cluster}
+	}
+	user := findKubeConfigUser(kubeconfig, contextParams.User)
+	if user == nil {
+		return ConnectionParameters{}, "", &UserNotFoundError{Name: contextParams.User}
+	}
+
+	clusterEntry := *cluster
+	if clusterEntry.Origin == "" {
+		clusterEntry.Origin = kubeconfig.Origin
 	}
-	if context == nil {
-		return ConnectionParameters{}, fmt.Errorf("current context %s not found in kubeconfig file", *kubeconfig.CurrentContext)
+	userEntry := *user
+	if userEntry.Origin == "" {
+		userEntry.Origin = kubeconfig.Origin
 	}
-	currentCluster := context.Context.Cluster
-	currentUser := context.Context.User
 
-	var cluster *KubeConfigCluster
+	connectionParams, err := kubeConfigEntriesToConnection(&clusterEntry, &userEntry, contextParams.Namespace, opts)
+	if err != nil {
+		return ConnectionParameters{}, "", err
+	}
+	return connectionParams, contextParams.Namespace, nil
+}
 
-	for _, clstr := range kubeconfig.Clusters {
-		if clstr.Name == currentCluster {
-			clstrLocal := clstr
-			cluster = &clstrLocal
+func findKubeConfigContext(kubeconfig KubeConfig, name string) *KubeConfigContext {
+	for i := range kubeconfig.Contexts {
+		if kubeconfig.Contexts[i].Name == name {
+			return &kubeconfig.Contexts[i]
 		}
 	}
-	if cluster == nil {
-		return ConnectionParameters{}, fmt.Errorf("current cluster %s not found in kubeconfig file", currentCluster)
+	return nil
+}
+
+func findKubeConfigCluster(kubeconfig KubeConfig, name string) *KubeConfigCluster {
+	for i := range kubeconfig.Clusters {
+		if kubeconfig.Clusters[i].Name == name {
+			return &kubeconfig.Clusters[i]
+		}
 	}
+	return nil
+}
 
-	var user *KubeConfigUser
-	for _, usr := range kubeconfig.Users {
-		if usr.Name == currentUser {
-			usrLocal := usr
-			user = &usrLocal
+func findKubeConfigUser(kubeconfig KubeConfig, name string) *KubeConfigUser {
+	for i := range kubeconfig.Users {
+		if kubeconfig.Users[i].Name == name {
+			return &kubeconfig.Users[i]
 		}
 	}
+	return nil
+}
 
-	if user == nil {
-		return ConnectionParameters{}, fmt.Errorf("current user %s not found in kubeconfig file", currentUser)
+// resolveKubeConfigPath resolves a file path referenced in a kubeconfig the same way kubectl does. A leading ~ is
+// expanded to the home directory of the current user and relative paths are resolved against the directory of the
+// file the entry was loaded from. Paths of entries without an origin are left relative to the working directory.
+func resolveKubeConfigPath(path string, origin string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand %s (%w)", path, err)
+		}
+		return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+	}
+	if filepath.IsAbs(path) || origin == "" {
+		return path, nil
 	}
+	return filepath.Join(filepath.Dir(origin), path), nil
+}
 
+// serverToHost converts the server URL of a kubeconfig cluster to the host of a connection. HTTPS servers without a
+// path are reduced to host and port. Other servers keep their scheme and path, so plain HTTP servers and servers
+// behind a path prefix round-trip unchanged through hostToServer.
+func serverToHost(server string) (string, error) {
+	if !strings.Contains(server, "://") {
+		return connectionHost(server)
+	}
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid cluster server URL %s (%w)", server, err)
+	}
+	if serverURL.Scheme != "http" && serverURL.Scheme != "https" {
+		return "", fmt.Errorf("unsupported cluster server URL scheme %s, expected http or https", serverURL.Scheme)
+	}
+	if serverURL.Host == "" {
+		return "", fmt.Errorf("no host in cluster server URL %s", server)
+	}
+	if serverURL.Scheme == "https" && serverURL.Path == "" && serverURL.RawQuery == "" {
+		return serverURL.Host, nil
+	}
+	return server, nil
+}
+
+// hostToServer converts the host of a connection to the server URL of a kubeconfig cluster. Hosts without a scheme
+// are served over HTTPS.
+func hostToServer(host string) (string, error) {
+	host, err := connectionHost(host)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(host, "://") {
+		return host, nil
+	}
+	return "https://" + host, nil
+}
+
+// connectionHost validates the host of a connection and encloses a bare IPv6 address in brackets. The host is either
+// a host name or address with an optional port, or a URL with an http or https scheme and an optional path prefix.
+func connectionHost(host string) (string, error) {
+	if strings.Contains(host, "://") {
+		if _, err := serverToHost(host); err != nil {
+			return "", err
+		}
+		return host, nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "[" + host + "]", nil
+	}
+	if strings.ContainsAny(host, "/?#") {
+		return "", fmt.Errorf("invalid host %s, a path prefix requires a URL with a scheme", host)
+	}
+	return host, nil
+}
+
+func kubeConfigEntriesToConnection(
+	cluster *KubeConfigCluster,
+	user *KubeConfigUser,
+	namespace string,
+	opts KubeConfigConnectionOptions,
+) (ConnectionParameters, error) {
+	inlineFiles := opts.InlineFiles
 	if len(cluster.Cluster.Server) == 0 {
-		return ConnectionParameters{}, errors.New("no cluster host found in connection")
+		return ConnectionParameters{}, &MissingServerError{Cluster: cluster.Name}
 	}
 
+	host, err := serverToHost(cluster.Cluster.Server)
+	if err != nil {
+		return ConnectionParameters{}, err
+	}
 	connectionParams := ConnectionParameters{
-		Host: strings.Replace(strings.Replace(cluster.Cluster.Server, "https://", "", 1), "http://", "", 1),
+		Host:      host,
+		Namespace: namespace,
 	}
 
 	if cluster.Cluster.CertificateAuthority != nil {
+		caFile, err := resolveKubeConfigPath(*cluster.Cluster.CertificateAuthority, cluster.Origin)
+		if err != nil {
+			return ConnectionParameters{}, err
+		}
 		if inlineFiles {
-			data, err := os.ReadFile(*cluster.Cluster.CertificateAuthority)
+			data, err := os.ReadFile(caFile)
 			if err != nil {
-				return ConnectionParameters{}, err
+				return ConnectionParameters{}, &CredentialFileError{Path: caFile, Err: err}
 			}
 			connectionParams.CAData = string(data)
 		} else {
-			connectionParams.CAFile = *cluster.Cluster.CertificateAuthority
+			connectionParams.CAFile = caFile
 		}
 	}
 
 	connectionParams.Insecure = cluster.Cluster.InsecureSkipTLSVerify
+	connectionParams.DisableCompression = cluster.Cluster.DisableCompression
+	if cluster.Cluster.TLSServerName != nil {
+		connectionParams.ServerName = *cluster.Cluster.TLSServerName
+	}
+	if cluster.Cluster.ProxyURL != nil {
+		connectionParams.ProxyURL = *cluster.Cluster.ProxyURL
+	}
 
 	if cluster.Cluster.CertificateAuthorityData != nil {
 		connectionParams.CAData = util.Base64Decode(*cluster.Cluster.CertificateAuthorityData)
 	}
+	connectionParams.PinnedSPKISHA256, err = pinnedSPKIFromExtensions(cluster.Cluster.Extensions)
+	if err != nil {
+		return ConnectionParameters{}, fmt.Errorf("invalid extensions in cluster %s (%w)", cluster.Name, err)
+	}
 
 	if user.User.ClientCertificate != nil {
+		certFile, err := resolveKubeConfigPath(*user.User.ClientCertificate, user.Origin)
+		if err != nil {
+			return ConnectionParameters{}, err
+		}
 		if inlineFiles {
-			data, err := os.ReadFile(*user.User.ClientCertificate)
+			data, err := os.ReadFile(certFile)
 			if err != nil {
-				return ConnectionParameters{}, err
+				return ConnectionParameters{}, &CredentialFileError{Path: certFile, Err: err}
 			}
 			connectionParams.CertData = string(data)
 		} else {
-			connectionParams.CertFile = *user.User.ClientCertificate
+			connectionParams.CertFile = certFile
 		}
 	}
 
@@ -107,14 +300,18 @@ func KubeConfigToConnection(kubeconfig KubeConfig, inlineFiles bool) (Connection
 	}
 
 	if user.User.ClientKey != nil {
+		keyFile, err := resolveKubeConfigPath(*user.User.ClientKey, user.Origin)
+		if err != nil {
+			return ConnectionParameters{}, err
+		}
 		if inlineFiles {
-			data, err := os.ReadFile(*user.User.ClientKey)
+			data, err := os.ReadFile(keyFile)
 			if err != nil {
-				return ConnectionParameters{}, err
+				return ConnectionParameters{}, &CredentialFileError{Path: keyFile, Err: err}
 			}
 			connectionParams.KeyData = string(data)
 		} else {
-			connectionParams.KeyFile = *user.User.ClientKey
+			connectionParams.KeyFile = keyFile
 		}
 	}
 	if user.User.ClientKeyData != nil {
@@ -130,10 +327,63 @@ func KubeConfigToConnection(kubeconfig KubeConfig, inlineFiles bool) (Connection
 	if user.User.Token != nil {
 		connectionParams.BearerToken = *user.User.Token
 	}
+	if user.User.TokenFile != nil {
+		tokenFile, err := resolveKubeConfigPath(*user.User.TokenFile, user.Origin)
+		if err != nil {
+			return ConnectionParameters{}, err
+		}
+		if inlineFiles {
+			data, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return ConnectionParameters{}, &CredentialFileError{Path: tokenFile, Err: err}
+			}
+			connectionParams.BearerToken = strings.TrimSpace(string(data))
+		} else {
+			connectionParams.BearerTokenFile = tokenFile
+		}
+	}
+	if user.User.As != nil {
+		impersonate := &ImpersonationConfig{User: *user.User.As}
+		if user.User.AsUID != nil {
+			impersonate.UID = *user.User.AsUID
+		}
+		if user.User.AsGroups != nil {
+			impersonate.Groups = *user.User.AsGroups
+		}
+		if user.User.AsUserExtra != nil {
+			impersonate.Extra = *user.User.AsUserExtra
+		}
+		connectionParams.Impersonate = impersonate
+	}
+	if user.User.Exec != nil {
+		execConfig := *user.User.Exec
+		// As in kubectl, only commands containing a path separator are resolved, bare commands are looked up in PATH.
+		if strings.ContainsRune(execConfig.Command, filepath.Separator) {
+			command, err := resolveKubeConfigPath(execConfig.Command, user.Origin)
+			if err != nil {
+				return ConnectionParameters{}, err
+			}
+			execConfig.Command = command
+		}
+		connectionParams.Exec = &execConfig
+	}
+	if user.User.AuthProvider != nil {
+		if user.User.AuthProvider.Name != OIDCAuthProviderName {
+			return ConnectionParameters{}, fmt.Errorf("unsupported auth provider: %s", user.User.AuthProvider.Name)
+		}
+		provider, err := oidcUserAuthProvider(user, opts.PersistOIDCTokens)
+		if err != nil {
+			return ConnectionParameters{}, err
+		}
+		connectionParams.OIDC = provider
+	}
 
 	if err := ConnectionParametersSchema().Validate(connectionParams); err != nil {
 		return ConnectionParameters{}, err
 	}
+	if err := validateClientKeyPair(connectionParams); err != nil {
+		return ConnectionParameters{}, err
+	}
 	return connectionParams, nil
 }
 
@@ -141,9 +391,13 @@ func ConnectionToKubeConfig(connection ConnectionParameters) (KubeConfig, error)
 	defaultStr := "default"
 	clusterParams := KubeConfigClusterParams{}
 	if len(connection.Host) == 0 {
-		return KubeConfig{}, errors.New("no cluster host found in connection")
+		return KubeConfig{}, &MissingServerError{}
 	}
-	clusterParams.Server = fmt.Sprintf("https://%s", connection.Host)
+	server, err := hostToServer(connection.Host)
+	if err != nil {
+		return KubeConfig{}, err
+	}
+	clusterParams.Server = server
 	if len(connection.CAData) > 0 {
 		caData := base64.StdEncoding.EncodeToString([]byte(connection.CAData))
 		clusterParams.CertificateAuthorityData = &caData
@@ -152,15 +406,31 @@ func ConnectionToKubeConfig(connection ConnectionParameters) (KubeConfig, error)
 		clusterParams.CertificateAuthority = &connection.CAFile
 	}
 	clusterParams.InsecureSkipTLSVerify = connection.Insecure
+	clusterParams.DisableCompression = connection.DisableCompression
+	if len(connection.ServerName) > 0 {
+		clusterParams.TLSServerName = &connection.ServerName
+	}
+	if len(connection.ProxyURL) > 0 {
+		clusterParams.ProxyURL = &connection.ProxyURL
+	}
+	if connection.PinnedSPKISHA256 != nil {
+		clusterParams.Extensions = []any{pinnedSPKIExtension(*connection.PinnedSPKISHA256)}
+	}
 	cluster := KubeConfigCluster{
 		Cluster: clusterParams,
 		Name:    defaultStr,
 	}
 
+	// Connections authenticating with a token or a certificate have no username, but the context must reference the
+	// user by a name for kubectl to resolve the credentials.
+	userName := connection.Username
+	if userName == "" {
+		userName = defaultStr
+	}
 	contextParams := KubeConfigContextParameters{}
-	contextParams.User = connection.Username
+	contextParams.User = userName
 	contextParams.Cluster = defaultStr
-	contextParams.Namespace = defaultStr
+	contextParams.Namespace = connection.Namespace
 	context := KubeConfigContext{
 		Context: contextParams,
 		Name:    defaultStr,
@@ -189,18 +459,37 @@ func ConnectionToKubeConfig(connection ConnectionParameters) (KubeConfig, error)
 		userParams.Token = &connection.BearerToken
 	}
 
-	if len(connection.BearerTokenFile) > 0 {
-		tokenData, err := os.ReadFile(connection.BearerTokenFile)
-		if err != nil {
-			return KubeConfig{}, err
+	// The token file is referenced rather than read, so kubectl picks up rotated tokens. It is only written when the
+	// connection uses it, as kubectl prefers it over the other credentials.
+	if tokenFile := connectionBearerTokenFile(connection); tokenFile != "" {
+		userParams.TokenFile = &tokenFile
+	}
+
+	userParams.Exec = connection.Exec
+	if connection.OIDC != nil {
+		authProvider := currentOIDCAuthProvider(*connection.OIDC).AuthProvider()
+		userParams.AuthProvider = &authProvider
+	}
+
+	if err := validateImpersonation(connection); err != nil {
+		return KubeConfig{}, err
+	}
+	if connection.Impersonate != nil {
+		userParams.As = &connection.Impersonate.User
+		if len(connection.Impersonate.UID) > 0 {
+			userParams.AsUID = &connection.Impersonate.UID
+		}
+		if len(connection.Impersonate.Groups) > 0 {
+			userParams.AsGroups = &connection.Impersonate.Groups
+		}
+		if len(connection.Impersonate.Extra) > 0 {
+			userParams.AsUserExtra = &connection.Impersonate.Extra
 		}
-		token := string(tokenData)
-		userParams.Token = &token
 	}
 
 	user := KubeConfigUser{
 		User: userParams,
-		Name: connection.Username,
+		Name: userName,
 	}
 
 	kubeconfig := KubeConfig{
@@ -217,24 +506,52 @@ func ConnectionToKubeConfig(connection ConnectionParameters) (KubeConfig, error)
 
 }
 
+// ConnectionToRestConfig converts the connection to a client-go rest config. A connection without a timeout gets the
+// default timeout of 10 seconds, while a zero timeout disables the timeout. The QPS and burst are passed through
+// unchanged, so as in client-go zero uses the client-go default. An empty user agent falls back to the default user
+// agent.
 func ConnectionToRestConfig(connection ConnectionParameters) (*restclient.Config, error) {
-	const defaultTimeOut = 10 * time.Second
+	return connectionToRestConfig(connection, tlsTransportOptions{})
+}
 
+// connectionToRestConfig converts the connection to a rest config whose transport additionally applies the TLS
+// options.
+func connectionToRestConfig(
+	connection ConnectionParameters,
+	tlsOptions tlsTransportOptions,
+) (*restclient.Config, error) {
 	if len(connection.Host) == 0 {
-		return nil, errors.New("no cluster host found in connection")
+		return nil, &MissingServerError{}
+	}
+	if err := validateImpersonation(connection); err != nil {
+		return nil, err
+	}
+	if err := validateClientKeyPair(connection); err != nil {
+		return nil, err
+	}
+
+	host, err := connectionHost(connection.Host)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := connectionProxy(connection)
+	if err != nil {
+		return nil, err
 	}
 
+	bearerTokenFile := connectionBearerTokenFile(connection)
 	clientConfig := restclient.Config{
-		Host:    connection.Host,
+		Host:    host,
 		APIPath: connection.APIPath,
 		ContentConfig: restclient.ContentConfig{
 			GroupVersion:         &core.SchemeGroupVersion,
 			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
 		},
-		Username:    connection.Username,
-		Password:    connection.Password,
-		BearerToken: connection.BearerToken,
-		Impersonate: restclient.ImpersonationConfig{},
+		Username:        connection.Username,
+		Password:        connection.Password,
+		BearerToken:     connection.BearerToken,
+		BearerTokenFile: bearerTokenFile,
+		Impersonate:     impersonationConfig(connection.Impersonate),
 		TLSClientConfig: restclient.TLSClientConfig{
 			ServerName: connection.ServerName,
 			CertData:   []byte(connection.CertData),
@@ -245,16 +562,117 @@ func ConnectionToRestConfig(connection ConnectionParameters) (*restclient.Config
 			CAFile:     connection.CAFile,
 			Insecure:   connection.Insecure,
 		},
-		UserAgent: "Arcaflow",
-		QPS:       restclient.DefaultQPS,
-		Burst:     restclient.DefaultBurst,
-		Timeout:   defaultTimeOut,
+		ExecProvider:       execProviderConfig(connection.Exec),
+		Proxy:              proxy,
+		DisableCompression: connection.DisableCompression,
+		UserAgent:          connection.UserAgent,
+		QPS:                connection.QPS,
+		Burst:              connection.Burst,
+		Timeout:            defaultTimeout,
+	}
+	if connection.Timeout != nil {
+		clientConfig.Timeout = *connection.Timeout
+	}
+	if clientConfig.UserAgent == "" {
+		clientConfig.UserAgent = defaultUserAgent
+	}
+	if connection.PinnedSPKISHA256 != nil {
+		if strings.HasPrefix(host, "http://") {
+			return nil, fmt.Errorf("pinned public keys require a TLS connection, but the host %s uses HTTP", host)
+		}
+		tlsOptions.verifyConnection = verifyPinnedSPKI(*connection.PinnedSPKISHA256)
+	}
+	if !tlsOptions.empty() {
+		// The TLS options must be applied to the transport client-go builds, so this wraps it first.
+		clientConfig.Wrap(newTLSTransportWrapper(tlsOptions))
+	}
+	if connection.OIDC != nil {
+		clientConfig.Wrap(newOIDCRoundTripper(*connection.OIDC))
+	}
+	if bearerTokenFile != "" {
+		clientConfig.Wrap(newTokenFileRefreshRoundTripper(bearerTokenFile))
 	}
 	return &clientConfig, nil
 }
 
+// connectionProxy returns the proxy function for the proxy URL of the connection, or nil to use the proxy from the
+// environment. Go's HTTP transport supports http, https and socks5 proxy URLs.
+func connectionProxy(connection ConnectionParameters) (func(*http.Request) (*url.URL, error), error) {
+	if connection.ProxyURL == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(connection.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %s (%w)", connection.ProxyURL, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy URL scheme %s, expected http, https or socks5", proxyURL.Scheme)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// validateImpersonation checks that an impersonation configuration names the user to impersonate, as the API server
+// rejects impersonated groups, UIDs and extra fields without a user.
+func validateImpersonation(connection ConnectionParameters) error {
+	if connection.Impersonate != nil && connection.Impersonate.User == "" {
+		return errors.New("impersonating a UID, groups or extra fields requires an impersonated user")
+	}
+	return nil
+}
+
+// impersonationConfig converts the impersonation configuration to the client-go representation.
+func impersonationConfig(impersonate *ImpersonationConfig) restclient.ImpersonationConfig {
+	if impersonate == nil {
+		return restclient.ImpersonationConfig{}
+	}
+	return restclient.ImpersonationConfig{
+		UserName: impersonate.User,
+		UID:      impersonate.UID,
+		Groups:   impersonate.Groups,
+		Extra:    impersonate.Extra,
+	}
+}
+
+// execProviderConfig converts the exec credential plugin configuration to the client-go representation. Client-go
+// invokes the plugin on the first request, caches the returned token or certificate until its expirationTimestamp and
+// invokes the plugin again once the credentials expire or the server rejects them.
+func execProviderConfig(execConfig *ExecConfig) *clientcmdapi.ExecConfig {
+	if execConfig == nil {
+		return nil
+	}
+	interactiveMode := clientcmdapi.ExecInteractiveMode(execConfig.InteractiveMode)
+	if interactiveMode == "" {
+		interactiveMode = clientcmdapi.IfAvailableExecInteractiveMode
+	}
+	apiVersion := execConfig.APIVersion
+	if apiVersion == "" {
+		apiVersion = "client.authentication.k8s.io/v1"
+	}
+	env := make([]clientcmdapi.ExecEnvVar, len(execConfig.Env))
+	for i, envVar := range execConfig.Env {
+		env[i] = clientcmdapi.ExecEnvVar{Name: envVar.Name, Value: envVar.Value}
+	}
+	return &clientcmdapi.ExecConfig{
+		Command:            execConfig.Command,
+		Args:               execConfig.Args,
+		Env:                env,
+		APIVersion:         apiVersion,
+		ProvideClusterInfo: execConfig.ProvideClusterInfo,
+		InteractiveMode:    interactiveMode,
+	}
+}
+
+// Client creates a Kubernetes clientset for the connection. If the connection authenticates with certificate and key
+// files, rotated certificates are picked up.
 func Client(connection ConnectionParameters) (*kubernetes.Clientset, error) {
-	config, err := ConnectionToRestConfig(connection)
+	return ClientWithOptions(connection, ClientOptions{})
+}
+
+// ClientWithOptions creates a Kubernetes clientset for the connection with the given options.
+func ClientWithOptions(connection ConnectionParameters, opts ClientOptions) (*kubernetes.Clientset, error) {
+	config, err := clientConfig(connection, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -265,12 +683,19 @@ func Client(connection ConnectionParameters) (*kubernetes.Clientset, error) {
 	return clientSet, nil
 }
 
+// RESTClient creates a REST client for the connection. If the connection authenticates with certificate and key
+// files, rotated certificates are picked up.
 func RESTClient(connection ConnectionParameters) (*restclient.RESTClient, error) {
-	clientConfig, err := ConnectionToRestConfig(connection)
+	return RESTClientWithOptions(connection, ClientOptions{})
+}
+
+// RESTClientWithOptions creates a REST client for the connection with the given options.
+func RESTClientWithOptions(connection ConnectionParameters, opts ClientOptions) (*restclient.RESTClient, error) {
+	config, err := clientConfig(connection, opts)
 	if err != nil {
 		return nil, err
 	}
-	client, err := restclient.RESTClientFor(clientConfig)
+	client, err := restclient.RESTClientFor(config)
 	if err != nil {
 		return nil, err
 	}
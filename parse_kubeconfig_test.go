@@ -1,9 +1,21 @@
 package arcaflow_lib_kubernetes
 
 import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -23,6 +35,7 @@ type testFixtures struct {
 	kubeconfigSkipTLS    string
 	tokenFile            string
 	kubeconfigExtensions string
+	kubeconfigMultiCtx   string
 }
 
 func NewFixtures(t *testing.T) testFixtures {
@@ -47,6 +60,8 @@ func NewFixtures(t *testing.T) testFixtures {
 	assert.Nil(t, err)
 	kubeExtensions, err := os.ReadFile("testdata/kubeconfig-extensions.yaml")
 	assert.Nil(t, err)
+	kubeMultiCtx, err := os.ReadFile("testdata/kubeconfig-multicontext.yaml")
+	assert.Nil(t, err)
 
 	return testFixtures{
 		caCert:               string(caCrt),
@@ -59,6 +74,7 @@ func NewFixtures(t *testing.T) testFixtures {
 		kubeconfigSkipTLS:    string(kubeTLSSkip),
 		tokenFile:            string(tokenFile),
 		kubeconfigExtensions: string(kubeExtensions),
+		kubeconfigMultiCtx:   string(kubeMultiCtx),
 	}
 }
 
@@ -119,6 +135,111 @@ func TestKubeConfigToConnection(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestKubeConfigToConnectionForContext(t *testing.T) {
+	fixtures := NewFixtures(t)
+	kubeconf, err := ParseKubeConfig(fixtures.kubeconfigMultiCtx)
+	assert.Nil(t, err)
+
+	// test that an empty context name selects the current context
+	connection, namespace, err := KubeConfigToConnectionForContext(kubeconf, "", KubeConfigConnectionOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:6443", connection.Host)
+	assert.Equal(t, CACERTPATH, connection.CAFile)
+	assert.Equal(t, "sha256~developer", connection.BearerToken)
+	assert.Equal(t, "dev-namespace", namespace)
+	assert.Equal(t, "dev-namespace", connection.Namespace)
+
+	// test selecting a context other than the current one
+	connection, namespace, err = KubeConfigToConnectionForContext(kubeconf, "prod", KubeConfigConnectionOptions{
+		InlineFiles: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:6443", connection.Host)
+	assert.True(t, connection.Insecure)
+	assert.Equal(t, fixtures.clientCrt, connection.CertData)
+	assert.Equal(t, fixtures.clientKey, connection.KeyData)
+	assert.Equal(t, "prod-namespace", namespace)
+
+	// test overriding the cluster, user and namespace of a context
+	connection, namespace, err = KubeConfigToConnectionForContext(kubeconf, "dev", KubeConfigConnectionOptions{
+		Cluster:   "prod",
+		User:      "operator",
+		Namespace: "other-namespace",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:6443", connection.Host)
+	assert.Equal(t, CERTPATH, connection.CertFile)
+	assert.Empty(t, connection.BearerToken)
+	assert.Equal(t, "other-namespace", namespace)
+	assert.Equal(t, "other-namespace", connection.Namespace)
+
+	// test that a cluster and user override can be used without any context
+	kubeconf.CurrentContext = nil
+	connection, namespace, err = KubeConfigToConnectionForContext(kubeconf, "", KubeConfigConnectionOptions{
+		Cluster: "dev",
+		User:    "developer",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:6443", connection.Host)
+	assert.Empty(t, namespace)
+	_, _, err = KubeConfigToConnectionForContext(kubeconf, "", KubeConfigConnectionOptions{Cluster: "dev"})
+	assert.NotNil(t, err)
+}
+
+func TestKubeConfigToConnectionErrors(t *testing.T) {
+	fixtures := NewFixtures(t)
+	kubeconf, err := ParseKubeConfig(fixtures.kubeconfigMultiCtx)
+	assert.Nil(t, err)
+	kubeconf.CurrentContext = nil
+
+	// test typed errors for missing references
+	var contextErr *ContextNotFoundError
+	_, _, err = KubeConfigToConnectionForContext(kubeconf, "missing", KubeConfigConnectionOptions{})
+	assert.ErrorAs(t, err, &contextErr)
+	assert.Equal(t, "missing", contextErr.Name)
+
+	var clusterErr *ClusterNotFoundError
+	_, _, err = KubeConfigToConnectionForContext(kubeconf, "staging", KubeConfigConnectionOptions{})
+	assert.ErrorAs(t, err, &clusterErr)
+	assert.Equal(t, "staging", clusterErr.Name)
+
+	var userErr *UserNotFoundError
+	_, _, err = KubeConfigToConnectionForContext(kubeconf, "dev", KubeConfigConnectionOptions{User: "nobody"})
+	assert.ErrorAs(t, err, &userErr)
+	assert.Equal(t, "nobody", userErr.Name)
+
+	_, _, err = KubeConfigToConnectionForContext(kubeconf, "", KubeConfigConnectionOptions{Cluster: "dev"})
+	assert.ErrorIs(t, err, ErrNoCurrentContext)
+	_, err = KubeConfigToConnection(kubeconf, false)
+	assert.ErrorIs(t, err, ErrNoCurrentContext)
+
+	// test typed errors for clusters without a server
+	var serverErr *MissingServerError
+	noServer := kubeconf
+	noServer.Clusters = []KubeConfigCluster{{Name: "dev"}}
+	_, _, err = KubeConfigToConnectionForContext(noServer, "dev", KubeConfigConnectionOptions{})
+	assert.ErrorAs(t, err, &serverErr)
+	assert.Equal(t, "dev", serverErr.Cluster)
+	_, err = ConnectionToRestConfig(ConnectionParameters{})
+	assert.ErrorAs(t, err, &serverErr)
+	assert.Empty(t, serverErr.Cluster)
+	_, err = ConnectionToKubeConfig(ConnectionParameters{})
+	assert.ErrorAs(t, err, &serverErr)
+
+	// test typed errors for unreadable credential files
+	var fileErr *CredentialFileError
+	missingFile := filepath.Join(t.TempDir(), "missing.crt")
+	missingCert := kubeconf
+	missingCert.Users = []KubeConfigUser{{
+		Name: "developer",
+		User: KubeConfigUserParameters{ClientCertificate: &missingFile},
+	}}
+	_, _, err = KubeConfigToConnectionForContext(missingCert, "dev", KubeConfigConnectionOptions{InlineFiles: true})
+	assert.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, missingFile, fileErr.Path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
 func TestConnectionToKubeConfig(t *testing.T) {
 	// test parsing without file inlining
 	fixtures := NewFixtures(t)
@@ -147,6 +268,481 @@ func TestConnectionToKubeConfig(t *testing.T) {
 	connection.BearerTokenFile = "testdata/tokenfile"
 	kubeconfBack, err = ConnectionToKubeConfig(connection)
 	assert.Nil(t, err)
+	// test that the token file is omitted when the connection authenticates with other credentials
+	assert.Nil(t, kubeconfBack.Users[0].User.TokenFile)
+	connection.Username = ""
+	connection.Password = ""
+	connection.CertFile = ""
+	connection.KeyFile = ""
+	kubeconfBack, err = ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Nil(t, kubeconfBack.Users[0].User.Token)
+	assert.Equal(t, &connection.BearerTokenFile, kubeconfBack.Users[0].User.TokenFile)
+	connectionBack, err := KubeConfigToConnection(kubeconfBack, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "testdata/tokenfile", connectionBack.BearerTokenFile)
+	connectionBack, err = KubeConfigToConnection(kubeconfBack, true)
+	assert.Nil(t, err)
+	assert.Equal(t, fixtures.tokenFile, connectionBack.BearerToken)
+	assert.Empty(t, connectionBack.BearerTokenFile)
+
+	// test that the default token file is omitted outside a pod
+	connection.BearerTokenFile = DefaultBearerTokenFile
+	kubeconfBack, err = ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Nil(t, kubeconfBack.Users[0].User.TokenFile)
+
+	// test that the namespace survives the conversion in both directions
+	connection.Namespace = "plugins"
+	kubeconfBack, err = ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, "plugins", kubeconfBack.Contexts[0].Context.Namespace)
+	connectionBack, err = KubeConfigToConnection(kubeconfBack, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "plugins", connectionBack.Namespace)
+}
+
+func TestWriteKubeConfig(t *testing.T) {
+	fixtures := NewFixtures(t)
+	expected, err := os.ReadFile("testdata/kubeconfig-extensions-written.yaml")
+	assert.Nil(t, err)
+	kubeconf, err := ParseKubeConfig(fixtures.kubeconfigExtensions)
+	assert.Nil(t, err)
+
+	// test that the output is stable and preserves extensions and preferences
+	for i := 0; i < 3; i++ {
+		buf := &bytes.Buffer{}
+		assert.Nil(t, WriteKubeConfig(buf, kubeconf))
+		assert.Equal(t, string(expected), buf.String())
+	}
+
+	// test that the written kubeconfig parses back into the same kubeconfig
+	buf := &bytes.Buffer{}
+	assert.Nil(t, WriteKubeConfig(buf, kubeconf))
+	kubeconfBack, err := ParseKubeConfig(buf.String())
+	assert.Nil(t, err)
 	assert.Equal(t, kubeconf, kubeconfBack)
 
+	// test writing a kubeconfig generated from a connection
+	kubeconf, err = ParseKubeConfig(fixtures.kubeconfigNoData)
+	assert.Nil(t, err)
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	kubeconfGenerated, err := ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	buf = &bytes.Buffer{}
+	assert.Nil(t, WriteKubeConfig(buf, kubeconfGenerated))
+	assert.NotContains(t, buf.String(), "null")
+	assert.NotContains(t, buf.String(), "insecure-skip-tls-verify")
+	kubeconfBack, err = ParseKubeConfig(buf.String())
+	assert.Nil(t, err)
+	assert.Equal(t, kubeconfGenerated, kubeconfBack)
+
+	// test that the credentials of a connection without a username can be resolved from the written kubeconfig
+	kubeconfGenerated, err = ConnectionToKubeConfig(ConnectionParameters{
+		Host:        "127.0.0.1:6443",
+		BearerToken: "sha256~token",
+	})
+	assert.Nil(t, err)
+	buf = &bytes.Buffer{}
+	assert.Nil(t, WriteKubeConfig(buf, kubeconfGenerated))
+	kubeconfBack, err = ParseKubeConfig(buf.String())
+	assert.Nil(t, err)
+	assert.Equal(t, "default", kubeconfBack.Contexts[0].Context.User)
+	assert.Empty(t, ValidateKubeConfig(kubeconfBack))
+	connection, err = KubeConfigToConnection(kubeconfBack, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256~token", connection.BearerToken)
+
+	// test that optional fields are omitted from a minimal kubeconfig
+	kubeconf, err = ParseKubeConfig("kind: Config\n")
+	assert.Nil(t, err)
+	buf = &bytes.Buffer{}
+	assert.Nil(t, WriteKubeConfig(buf, kubeconf))
+	assert.NotContains(t, buf.String(), "current-context")
+}
+
+const execKubeConfig = `apiVersion: v1
+clusters:
+  - cluster:
+      server: https://127.0.0.1:6443
+    name: default
+contexts:
+  - context:
+      cluster: default
+      user: default
+    name: default
+current-context: default
+kind: Config
+users:
+  - name: default
+    user:
+      exec:
+        apiVersion: client.authentication.k8s.io/v1
+        command: ./bin/credential-plugin
+        args:
+          - get-token
+        env:
+          - name: PLUGIN_MODE
+            value: test
+        interactiveMode: Never
+        provideClusterInfo: true
+`
+
+func TestKubeConfigExec(t *testing.T) {
+	kubeconf, err := ParseKubeConfig(execKubeConfig)
+	assert.Nil(t, err)
+	kubeconf.Origin = "/home/user/.kube/config"
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, &ExecConfig{
+		Command:            "/home/user/.kube/bin/credential-plugin",
+		Args:               []string{"get-token"},
+		Env:                []ExecEnvVar{{Name: "PLUGIN_MODE", Value: "test"}},
+		APIVersion:         "client.authentication.k8s.io/v1",
+		InteractiveMode:    "Never",
+		ProvideClusterInfo: true,
+	}, connection.Exec)
+
+	kubeconfBack, err := ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, connection.Exec, kubeconfBack.Users[0].User.Exec)
+	buf := &bytes.Buffer{}
+	assert.Nil(t, WriteKubeConfig(buf, kubeconfBack))
+	assert.Contains(t, buf.String(), "provideClusterInfo: true")
+
+	// test that commands without a path separator are looked up in PATH
+	kubeconf.Users[0].User.Exec.Command = "credential-plugin"
+	connection, err = KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "credential-plugin", connection.Exec.Command)
+}
+
+// writeExecPlugin writes a shell script credential plugin that records each invocation in a counter file and
+// returns a token expiring at the given time.
+func writeExecPlugin(t *testing.T, token string, expiration time.Time) (string, string) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "invocations")
+	plugin := filepath.Join(dir, "plugin.sh")
+	script := fmt.Sprintf(`#!/bin/sh
+echo invoked >> "$COUNTER_FILE"
+cat <<EOF
+{
+  "apiVersion": "client.authentication.k8s.io/v1",
+  "kind": "ExecCredential",
+  "status": {"token": "%s", "expirationTimestamp": "%s"}
+}
+EOF
+`, token, expiration.UTC().Format(time.RFC3339))
+	assert.Nil(t, os.WriteFile(plugin, []byte(script), 0700))
+	return plugin, counter
+}
+
+func countExecInvocations(t *testing.T, counter string) int {
+	data, err := os.ReadFile(counter)
+	assert.Nil(t, err)
+	return strings.Count(string(data), "invoked")
+}
+
+func TestConnectionToRestConfigExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer exec-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	defer server.Close()
+
+	for name, testCase := range map[string]struct {
+		expiration          time.Time
+		expectedInvocations int
+	}{
+		"cached":  {time.Now().Add(time.Hour), 1},
+		"expired": {time.Now().Add(-time.Hour), 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			plugin, counter := writeExecPlugin(t, "exec-token", testCase.expiration)
+			connection := ConnectionParameters{
+				Host: strings.TrimPrefix(server.URL, "http://"),
+				Exec: &ExecConfig{
+					Command: plugin,
+					Env:     []ExecEnvVar{{Name: "COUNTER_FILE", Value: counter}},
+				},
+			}
+			client, err := Client(connection)
+			assert.Nil(t, err)
+			for i := 0; i < 3; i++ {
+				version, err := client.Discovery().ServerVersion()
+				assert.Nil(t, err)
+				assert.Equal(t, "v1.33.2", version.GitVersion)
+			}
+			assert.Equal(t, testCase.expectedInvocations, countExecInvocations(t, counter))
+		})
+	}
+}
+
+const impersonationKubeConfig = `apiVersion: v1
+clusters:
+  - cluster:
+      server: https://127.0.0.1:6443
+    name: default
+contexts:
+  - context:
+      cluster: default
+      user: default
+    name: default
+current-context: default
+kind: Config
+users:
+  - name: default
+    user:
+      token: sha256~token
+      as: system:serviceaccount:plugins:runner
+      as-uid: "1234"
+      as-groups:
+        - system:authenticated
+      as-user-extra:
+        scopes:
+          - view
+`
+
+func TestKubeConfigImpersonation(t *testing.T) {
+	kubeconf, err := ParseKubeConfig(impersonationKubeConfig)
+	assert.Nil(t, err)
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, &ImpersonationConfig{
+		User:   "system:serviceaccount:plugins:runner",
+		UID:    "1234",
+		Groups: []string{"system:authenticated"},
+		Extra:  map[string][]string{"scopes": {"view"}},
+	}, connection.Impersonate)
+
+	kubeconfBack, err := ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, kubeconf.Users[0].User.As, kubeconfBack.Users[0].User.As)
+	assert.Equal(t, kubeconf.Users[0].User.AsUID, kubeconfBack.Users[0].User.AsUID)
+	assert.Equal(t, kubeconf.Users[0].User.AsGroups, kubeconfBack.Users[0].User.AsGroups)
+	assert.Equal(t, kubeconf.Users[0].User.AsUserExtra, kubeconfBack.Users[0].User.AsUserExtra)
+	buf := &bytes.Buffer{}
+	assert.Nil(t, WriteKubeConfig(buf, kubeconfBack))
+	kubeconfWritten, err := ParseKubeConfig(buf.String())
+	assert.Nil(t, err)
+	assert.Equal(t, kubeconf.Users[0].User.AsGroups, kubeconfWritten.Users[0].User.AsGroups)
+	assert.Equal(t, kubeconf.Users[0].User.AsUserExtra, kubeconfWritten.Users[0].User.AsUserExtra)
+
+	// test that groups without a user are rejected
+	_, err = ParseKubeConfig(strings.Replace(impersonationKubeConfig, "      as: system:serviceaccount:plugins:runner\n", "", 1))
+	assert.NotNil(t, err)
+	_, err = ConnectionToRestConfig(ConnectionParameters{
+		Host:        "127.0.0.1:6443",
+		Impersonate: &ImpersonationConfig{Groups: []string{"system:authenticated"}},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestConnectionToRestConfigImpersonation(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	defer server.Close()
+
+	client, err := Client(ConnectionParameters{
+		Host: strings.TrimPrefix(server.URL, "http://"),
+		Impersonate: &ImpersonationConfig{
+			User:   "system:serviceaccount:plugins:runner",
+			UID:    "1234",
+			Groups: []string{"system:authenticated"},
+			Extra:  map[string][]string{"scopes": {"view"}},
+		},
+	})
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "system:serviceaccount:plugins:runner", headers.Get("Impersonate-User"))
+	assert.Equal(t, "1234", headers.Get("Impersonate-Uid"))
+	assert.Equal(t, []string{"system:authenticated"}, headers.Values("Impersonate-Group"))
+	assert.Equal(t, "view", headers.Get("Impersonate-Extra-Scopes"))
+}
+
+const proxyKubeConfig = `apiVersion: v1
+clusters:
+  - cluster:
+      server: https://127.0.0.1:6443
+      tls-server-name: kubernetes.default.svc
+      proxy-url: http://proxy.example.com:3128
+      disable-compression: true
+    name: default
+contexts:
+  - context:
+      cluster: default
+      user: default
+    name: default
+current-context: default
+kind: Config
+users:
+  - name: default
+    user:
+      token: sha256~token
+`
+
+func TestKubeConfigProxy(t *testing.T) {
+	kubeconf, err := ParseKubeConfig(proxyKubeConfig)
+	assert.Nil(t, err)
+	connection, err := KubeConfigToConnection(kubeconf, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "kubernetes.default.svc", connection.ServerName)
+	assert.Equal(t, "http://proxy.example.com:3128", connection.ProxyURL)
+	assert.True(t, connection.DisableCompression)
+
+	kubeconfBack, err := ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, kubeconf.Clusters[0].Cluster.TLSServerName, kubeconfBack.Clusters[0].Cluster.TLSServerName)
+	assert.Equal(t, kubeconf.Clusters[0].Cluster.ProxyURL, kubeconfBack.Clusters[0].Cluster.ProxyURL)
+	assert.True(t, kubeconfBack.Clusters[0].Cluster.DisableCompression)
+
+	config, err := ConnectionToRestConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, "kubernetes.default.svc", config.ServerName)
+	assert.True(t, config.DisableCompression)
+	proxyURL, err := config.Proxy(&http.Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+
+	connection.ProxyURL = "ftp://proxy.example.com"
+	_, err = ConnectionToRestConfig(connection)
+	assert.NotNil(t, err)
+}
+
+// newConnectProxy starts an HTTP proxy that tunnels CONNECT requests and records the tunnelled addresses.
+func newConnectProxy(t *testing.T) (*httptest.Server, *[]string) {
+	var lock sync.Mutex
+	var tunnels []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		lock.Lock()
+		tunnels = append(tunnels, r.Host)
+		lock.Unlock()
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, &tunnels
+}
+
+func TestConnectionToRestConfigProxy(t *testing.T) {
+	var acceptEncodings []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncodings = append(acceptEncodings, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	defer server.Close()
+	proxy, tunnels := newConnectProxy(t)
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	connection := ConnectionParameters{
+		Host:        host,
+		CAData:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+		BearerToken: "sha256~token",
+		ProxyURL:    proxy.URL,
+	}
+	client, err := Client(connection)
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+
+	// test disabling compression through the proxy with the client certificate transport
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir(), "client")
+	connection.BearerToken = ""
+	connection.CertFile = certFile
+	connection.KeyFile = keyFile
+	connection.DisableCompression = true
+	client, err = Client(connection)
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{host, host}, *tunnels)
+	assert.Equal(t, []string{"gzip", ""}, acceptEncodings)
+}
+
+func TestKubeConfigServerRoundTrip(t *testing.T) {
+	for server, expectedHost := range map[string]string{
+		"https://127.0.0.1:6443":                     "127.0.0.1:6443",
+		"https://kubernetes.example.com":             "kubernetes.example.com",
+		"https://[::1]:6443":                         "[::1]:6443",
+		"http://127.0.0.1:8080":                      "http://127.0.0.1:8080",
+		"https://rancher.example.com/k8s/clusters/c": "https://rancher.example.com/k8s/clusters/c",
+		"https://[2001:db8::1]/k8s/clusters/c":       "https://[2001:db8::1]/k8s/clusters/c",
+	} {
+		t.Run(server, func(t *testing.T) {
+			kubeconf, err := ParseKubeConfig(strings.Replace(execKubeConfig, "https://127.0.0.1:6443", server, 1))
+			assert.Nil(t, err)
+			connection, err := KubeConfigToConnection(kubeconf, false)
+			assert.Nil(t, err)
+			assert.Equal(t, expectedHost, connection.Host)
+			kubeconfBack, err := ConnectionToKubeConfig(connection)
+			assert.Nil(t, err)
+			assert.Equal(t, server, kubeconfBack.Clusters[0].Cluster.Server)
+			connectionBack, err := KubeConfigToConnection(kubeconfBack, false)
+			assert.Nil(t, err)
+			assert.Equal(t, connection, connectionBack)
+		})
+	}
+
+	// test that bare IPv6 addresses are enclosed in brackets
+	server, err := hostToServer("::1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://[::1]", server)
+
+	// test invalid servers and hosts
+	_, err = serverToHost("ftp://127.0.0.1:6443")
+	assert.NotNil(t, err)
+	_, err = serverToHost("https:///k8s")
+	assert.NotNil(t, err)
+	_, err = ConnectionToRestConfig(ConnectionParameters{Host: "127.0.0.1:6443/k8s"})
+	assert.NotNil(t, err)
+}
+
+func TestConnectionToRestConfigPathPrefix(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	defer server.Close()
+
+	client, err := Client(ConnectionParameters{Host: server.URL + "/k8s/clusters/c-xyz"})
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/k8s/clusters/c-xyz/version"}, paths)
 }
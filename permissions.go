@@ -0,0 +1,126 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// permissionCheckConcurrency is the maximum number of access reviews CheckPermissions runs at the same time.
+const permissionCheckConcurrency = 8
+
+// PermissionRequirement is an action a plugin needs to be allowed to perform. An empty namespace requires the
+// permission cluster-wide, an empty name requires it for all objects of the resource.
+type PermissionRequirement struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	Namespace   string
+	Name        string
+}
+
+func (r PermissionRequirement) String() string {
+	resource := r.Resource
+	if r.Group != "" {
+		resource += "." + r.Group
+	}
+	if r.Subresource != "" {
+		resource += "/" + r.Subresource
+	}
+	if r.Name != "" {
+		resource += "/" + r.Name
+	}
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s %s (cluster-wide)", r.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", r.Verb, resource, r.Namespace)
+}
+
+// PermissionResult is the outcome of the access review of a single requirement. Reason holds the explanation of the
+// authorizer, if it gave one. Err is set if the access review itself failed, in which case Allowed is false.
+type PermissionResult struct {
+	Requirement PermissionRequirement
+	Allowed     bool
+	Denied      bool
+	Reason      string
+	Err         error
+}
+
+// CheckPermissions asks the API server whether the client is allowed to perform each of the required actions using
+// SelfSubjectAccessReviews, which are sent in parallel. The results are returned in the order of the requirements. A
+// requirement that is not allowed does not cause an error, the error only reports access reviews that failed.
+func CheckPermissions(
+	ctx context.Context,
+	client kubernetes.Interface,
+	requirements []PermissionRequirement,
+) ([]PermissionResult, error) {
+	results := make([]PermissionResult, len(requirements))
+	semaphore := make(chan struct{}, permissionCheckConcurrency)
+	wg := &sync.WaitGroup{}
+	for i, requirement := range requirements {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			results[i] = checkPermission(ctx, client, requirement)
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func checkPermission(
+	ctx context.Context,
+	client kubernetes.Interface,
+	requirement PermissionRequirement,
+) PermissionResult {
+	review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(
+		ctx,
+		&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   requirement.Namespace,
+					Verb:        requirement.Verb,
+					Group:       requirement.Group,
+					Resource:    requirement.Resource,
+					Subresource: requirement.Subresource,
+					Name:        requirement.Name,
+				},
+			},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return PermissionResult{
+			Requirement: requirement,
+			Err:         fmt.Errorf("failed to review permission to %s (%w)", requirement, err),
+		}
+	}
+	result := PermissionResult{
+		Requirement: requirement,
+		Allowed:     review.Status.Allowed,
+		Denied:      review.Status.Denied,
+		Reason:      review.Status.Reason,
+	}
+	if review.Status.EvaluationError != "" {
+		if result.Reason != "" {
+			result.Reason += ": "
+		}
+		result.Reason += review.Status.EvaluationError
+	}
+	return result
+}
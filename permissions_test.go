@@ -0,0 +1,69 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	client := fake.NewClientset()
+	client.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			switch {
+			case attributes.Resource == "nodes":
+				return true, nil, errors.New("connection refused")
+			case attributes.Namespace == "plugins" && attributes.Verb != "delete":
+				review.Status = authorizationv1.SubjectAccessReviewStatus{
+					Allowed: true,
+					Reason:  `RBAC: allowed by RoleBinding "runner/plugins"`,
+				}
+			case attributes.Namespace == "":
+				review.Status = authorizationv1.SubjectAccessReviewStatus{
+					Denied: true,
+					Reason: "cluster-wide access is forbidden",
+				}
+			default:
+				review.Status = authorizationv1.SubjectAccessReviewStatus{EvaluationError: "no RBAC policy matched"}
+			}
+			return true, review, nil
+		})
+
+	requirements := []PermissionRequirement{
+		{Verb: "create", Resource: "pods", Namespace: "plugins"},
+		{Verb: "get", Resource: "pods", Subresource: "log", Namespace: "plugins"},
+		{Verb: "delete", Resource: "pods", Namespace: "plugins"},
+		{Verb: "list", Group: "apps", Resource: "deployments"},
+		{Verb: "get", Resource: "nodes"},
+	}
+	results, err := CheckPermissions(context.Background(), client, requirements)
+	assert.ErrorContains(t, err, "failed to review permission to get nodes (cluster-wide) (connection refused)")
+	assert.Len(t, results, len(requirements))
+	for i, result := range results {
+		assert.Equal(t, requirements[i], result.Requirement)
+	}
+
+	assert.True(t, results[0].Allowed)
+	assert.Equal(t, `RBAC: allowed by RoleBinding "runner/plugins"`, results[0].Reason)
+	assert.True(t, results[1].Allowed)
+	assert.False(t, results[2].Allowed)
+	assert.False(t, results[2].Denied)
+	assert.Equal(t, "no RBAC policy matched", results[2].Reason)
+	assert.False(t, results[3].Allowed)
+	assert.True(t, results[3].Denied)
+	assert.Equal(t, "list deployments.apps (cluster-wide)", results[3].Requirement.String())
+	assert.False(t, results[4].Allowed)
+	assert.NotNil(t, results[4].Err)
+	assert.Nil(t, results[0].Err)
+
+	results, err = CheckPermissions(context.Background(), client, requirements[:2])
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+}
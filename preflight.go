@@ -0,0 +1,252 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// ConnectionCheckStage is a stage of CheckConnection.
+type ConnectionCheckStage string
+
+// The stages of CheckConnection in the order they run.
+const (
+	ConnectionCheckStageDNS            ConnectionCheckStage = "dns"
+	ConnectionCheckStageTCP            ConnectionCheckStage = "tcp"
+	ConnectionCheckStageTLS            ConnectionCheckStage = "tls"
+	ConnectionCheckStageVersion        ConnectionCheckStage = "version"
+	ConnectionCheckStageReadiness      ConnectionCheckStage = "readyz"
+	ConnectionCheckStageAuthentication ConnectionCheckStage = "authentication"
+)
+
+// ConnectionCheckStageResult is the outcome of a single stage of CheckConnection. Skipped stages do not apply to the
+// connection, for example the TLS stage of a plain HTTP server, or the network stages if a proxy is used.
+type ConnectionCheckStageResult struct {
+	Stage    ConnectionCheckStage
+	Skipped  bool
+	Duration time.Duration
+	Err      error
+}
+
+// ConnectionReport is the result of CheckConnection. Stages holds the stages that ran, up to and including the failed
+// stage, if any.
+type ConnectionReport struct {
+	Stages      []ConnectionCheckStageResult
+	FailedStage ConnectionCheckStage
+	// Addresses holds the addresses the server host name resolved to.
+	Addresses []string
+	// ServerVersion is the version reported by the /version endpoint.
+	ServerVersion *version.Info
+	// Identity is the user the API server authenticated the connection as.
+	Identity *authenticationv1.UserInfo
+}
+
+// CheckConnection checks that the cluster is reachable and accepts the credentials of the connection. It resolves the
+// server host name, opens a TCP connection, performs the TLS handshake, queries /version and /readyz, and finally
+// asks the API server who the connection is authenticated as with a SelfSubjectReview. The checks stop at the first
+// failed stage. In that case both the report and a ConnectionCheckError are returned. An error without a report means
+// the connection parameters themselves are invalid.
+func CheckConnection(ctx context.Context, connection ConnectionParameters) (*ConnectionReport, error) {
+	config, err := clientConfig(connection, ClientOptions{})
+	if err != nil {
+		return nil, err
+	}
+	tlsSettings, err := ConnectionToRestConfig(connection)
+	if err != nil {
+		return nil, err
+	}
+	serverURL, _, err := restclient.DefaultServerUrlFor(config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &connectionChecker{
+		connection:  connection,
+		config:      config,
+		tlsSettings: tlsSettings,
+		serverURL:   serverURL,
+		client:      client,
+		report:      &ConnectionReport{},
+	}
+	proxied, err := checker.proxied()
+	if err != nil {
+		return nil, err
+	}
+	stages := []struct {
+		stage ConnectionCheckStage
+		skip  bool
+		check func(ctx context.Context) error
+	}{
+		{ConnectionCheckStageDNS, proxied, checker.checkDNS},
+		{ConnectionCheckStageTCP, proxied, checker.checkTCP},
+		{ConnectionCheckStageTLS, proxied || serverURL.Scheme != "https", checker.checkTLS},
+		{ConnectionCheckStageVersion, false, checker.checkVersion},
+		{ConnectionCheckStageReadiness, false, checker.checkReadiness},
+		{ConnectionCheckStageAuthentication, false, checker.checkAuthentication},
+	}
+	for _, stage := range stages {
+		if stage.skip {
+			checker.report.Stages = append(checker.report.Stages, ConnectionCheckStageResult{
+				Stage:   stage.stage,
+				Skipped: true,
+			})
+			continue
+		}
+		start := time.Now()
+		err := stage.check(ctx)
+		checker.report.Stages = append(checker.report.Stages, ConnectionCheckStageResult{
+			Stage:    stage.stage,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+		if err != nil {
+			checker.report.FailedStage = stage.stage
+			return checker.report, &ConnectionCheckError{Stage: stage.stage, Err: err}
+		}
+	}
+	return checker.report, nil
+}
+
+type connectionChecker struct {
+	connection  ConnectionParameters
+	config      *restclient.Config
+	tlsSettings *restclient.Config
+	serverURL   *url.URL
+	client      kubernetes.Interface
+	report      *ConnectionReport
+}
+
+// proxied returns true if requests to the server go through a proxy, in which case the network stages cannot be
+// checked directly.
+func (c *connectionChecker) proxied() (bool, error) {
+	proxy := http.ProxyFromEnvironment
+	if c.config.Proxy != nil {
+		proxy = c.config.Proxy
+	}
+	proxyURL, err := proxy(&http.Request{URL: c.serverURL})
+	if err != nil {
+		return false, fmt.Errorf("failed to determine the proxy for %s (%w)", c.serverURL, err)
+	}
+	return proxyURL != nil, nil
+}
+
+func (c *connectionChecker) address() string {
+	port := c.serverURL.Port()
+	if port == "" {
+		port = "443"
+		if c.serverURL.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(c.serverURL.Hostname(), port)
+}
+
+func (c *connectionChecker) checkDNS(ctx context.Context) error {
+	host := c.serverURL.Hostname()
+	if net.ParseIP(host) != nil {
+		c.report.Addresses = []string{host}
+		return nil
+	}
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s (%w)", host, err)
+	}
+	c.report.Addresses = addresses
+	return nil
+}
+
+func (c *connectionChecker) checkTCP(ctx context.Context) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address())
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s (%w)", c.address(), err)
+	}
+	return conn.Close()
+}
+
+func (c *connectionChecker) checkTLS(ctx context.Context) error {
+	tlsConfig, err := restclient.TLSConfigFor(c.tlsSettings)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = c.serverURL.Hostname()
+	}
+	if c.connection.PinnedSPKISHA256 != nil {
+		tlsConfig.VerifyConnection = verifyPinnedSPKI(*c.connection.PinnedSPKISHA256)
+	}
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address())
+	if err != nil {
+		return fmt.Errorf("TLS handshake with %s failed (%w)", c.address(), err)
+	}
+	return conn.Close()
+}
+
+func (c *connectionChecker) checkVersion(ctx context.Context) error {
+	data, err := c.client.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return fmt.Errorf("failed to query the server version (%w)", err)
+	}
+	info := &version.Info{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return fmt.Errorf("failed to decode the server version (%w)", err)
+	}
+	c.report.ServerVersion = info
+	return nil
+}
+
+// checkReadiness queries /readyz, falling back to /healthz on servers older than Kubernetes 1.16.
+func (c *connectionChecker) checkReadiness(ctx context.Context) error {
+	restClient := c.client.Discovery().RESTClient()
+	_, err := restClient.Get().AbsPath("/readyz").Do(ctx).Raw()
+	if apierrors.IsNotFound(err) {
+		_, err = restClient.Get().AbsPath("/healthz").Do(ctx).Raw()
+	}
+	if err != nil {
+		return fmt.Errorf("the API server is not ready (%w)", err)
+	}
+	return nil
+}
+
+// checkAuthentication creates a SelfSubjectReview, falling back to the beta API on Kubernetes 1.27.
+func (c *connectionChecker) checkAuthentication(ctx context.Context) error {
+	review, err := c.client.AuthenticationV1().SelfSubjectReviews().Create(
+		ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{},
+	)
+	if err == nil {
+		c.report.Identity = &review.Status.UserInfo
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("authentication failed (%w)", err)
+	}
+	betaReview, err := c.client.AuthenticationV1beta1().SelfSubjectReviews().Create(
+		ctx, &authenticationv1beta1.SelfSubjectReview{}, metav1.CreateOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("authentication failed (%w)", err)
+	}
+	c.report.Identity = &betaReview.Status.UserInfo
+	return nil
+}
@@ -0,0 +1,124 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newAPIServer starts a TLS server that serves the endpoints CheckConnection queries and accepts the given token.
+func newAPIServer(t *testing.T, token string, ready bool) (*httptest.Server, ConnectionParameters) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/version":
+			_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+		case r.URL.Path == "/readyz" && ready:
+			_, _ = w.Write([]byte(`ok`))
+		case r.URL.Path == "/readyz":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`[-]etcd failed: reason withheld`))
+		case r.Header.Get("Authorization") != "Bearer "+token:
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "Unauthorized", "code": 401}`))
+		case r.URL.Path == "/apis/authentication.k8s.io/v1/selfsubjectreviews" && r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"kind": "SelfSubjectReview", "apiVersion": "authentication.k8s.io/v1", "status": {` +
+				`"userInfo": {"username": "system:serviceaccount:plugins:runner", "groups": ["system:authenticated"]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, ConnectionParameters{
+		Host:        strings.TrimPrefix(server.URL, "https://"),
+		CAData:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+		BearerToken: token,
+	}
+}
+
+func stageNames(report *ConnectionReport) []ConnectionCheckStage {
+	var stages []ConnectionCheckStage
+	for _, stage := range report.Stages {
+		stages = append(stages, stage.Stage)
+	}
+	return stages
+}
+
+func TestCheckConnection(t *testing.T) {
+	_, connection := newAPIServer(t, "token", true)
+
+	report, err := CheckConnection(context.Background(), connection)
+	assert.Nil(t, err)
+	assert.Empty(t, report.FailedStage)
+	assert.Equal(t, []ConnectionCheckStage{
+		ConnectionCheckStageDNS,
+		ConnectionCheckStageTCP,
+		ConnectionCheckStageTLS,
+		ConnectionCheckStageVersion,
+		ConnectionCheckStageReadiness,
+		ConnectionCheckStageAuthentication,
+	}, stageNames(report))
+	assert.Equal(t, []string{"127.0.0.1"}, report.Addresses)
+	assert.Equal(t, "v1.33.2", report.ServerVersion.GitVersion)
+	assert.Equal(t, "system:serviceaccount:plugins:runner", report.Identity.Username)
+	assert.Equal(t, []string{"system:authenticated"}, report.Identity.Groups)
+}
+
+func TestCheckConnectionFailures(t *testing.T) {
+	_, connection := newAPIServer(t, "token", true)
+	_, notReady := newAPIServer(t, "token", false)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closedAddress := listener.Addr().String()
+	assert.Nil(t, listener.Close())
+
+	unresolvable := connection
+	unresolvable.Host = "kubernetes.invalid:6443"
+	closed := connection
+	closed.Host = closedAddress
+	untrusted := connection
+	untrusted.CAData = ""
+	untrusted.CAFile = CACERTPATH
+	unauthenticated := connection
+	unauthenticated.BearerToken = "wrong-token"
+
+	for name, testCase := range map[string]struct {
+		connection ConnectionParameters
+		stage      ConnectionCheckStage
+	}{
+		"dns":            {unresolvable, ConnectionCheckStageDNS},
+		"tcp":            {closed, ConnectionCheckStageTCP},
+		"tls":            {untrusted, ConnectionCheckStageTLS},
+		"readyz":         {notReady, ConnectionCheckStageReadiness},
+		"authentication": {unauthenticated, ConnectionCheckStageAuthentication},
+	} {
+		t.Run(name, func(t *testing.T) {
+			report, err := CheckConnection(context.Background(), testCase.connection)
+			var checkErr *ConnectionCheckError
+			assert.ErrorAs(t, err, &checkErr)
+			assert.Equal(t, testCase.stage, checkErr.Stage)
+			assert.Equal(t, testCase.stage, report.FailedStage)
+			last := report.Stages[len(report.Stages)-1]
+			assert.Equal(t, testCase.stage, last.Stage)
+			assert.NotNil(t, last.Err)
+		})
+	}
+
+	// test that the network stages are skipped behind a proxy
+	proxy, tunnels := newConnectProxy(t)
+	proxied := connection
+	proxied.ProxyURL = proxy.URL
+	report, err := CheckConnection(context.Background(), proxied)
+	assert.Nil(t, err)
+	assert.True(t, report.Stages[0].Skipped)
+	assert.True(t, report.Stages[2].Skipped)
+	assert.False(t, report.Stages[3].Skipped)
+	assert.NotEmpty(t, *tunnels)
+}
@@ -0,0 +1,168 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSourceUnavailable is wrapped by connection sources that have nothing to offer, for example because the
+// kubeconfig file does not exist. ResolveConnection skips such sources and moves on to the next one.
+var ErrSourceUnavailable = errors.New("connection source unavailable")
+
+// ErrNoConnection indicates that none of the connection sources passed to ResolveConnection were available.
+var ErrNoConnection = errors.New("no connection source is available")
+
+// ConnectionSource provides connection parameters for ResolveConnection.
+type ConnectionSource interface {
+	// Name returns a human-readable name of the source for the resolution trace.
+	Name() string
+	// Resolve returns the connection parameters of this source. If the source has nothing to offer, the returned
+	// error must wrap ErrSourceUnavailable.
+	Resolve(ctx context.Context) (ConnectionParameters, error)
+}
+
+// ConnectionSourceAttempt records the outcome of a connection source tried by ResolveConnection.
+type ConnectionSourceAttempt struct {
+	// Source is the name of the connection source.
+	Source string
+	// Selected is true for the source that provided the returned connection parameters.
+	Selected bool
+	// Err holds the reason the source was skipped or failed.
+	Err error
+}
+
+// ResolveConnection tries the connection sources in order and returns the connection parameters of the first one
+// that is available, together with a trace of every source tried. Sources that return an error wrapping
+// ErrSourceUnavailable are skipped. Any other error, for example a malformed kubeconfig, stops the resolution so a
+// broken configuration does not silently fall through to a different cluster. If no source is available, the
+// returned error wraps ErrNoConnection.
+func ResolveConnection(ctx context.Context, sources ...ConnectionSource) (ConnectionParameters, []ConnectionSourceAttempt, error) {
+	trace := make([]ConnectionSourceAttempt, 0, len(sources))
+	for _, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return ConnectionParameters{}, trace, err
+		}
+		connection, err := source.Resolve(ctx)
+		trace = append(trace, ConnectionSourceAttempt{
+			Source:   source.Name(),
+			Selected: err == nil,
+			Err:      err,
+		})
+		switch {
+		case err == nil:
+			return connection, trace, nil
+		case !errors.Is(err, ErrSourceUnavailable):
+			return ConnectionParameters{}, trace, fmt.Errorf("connection source %s failed (%w)", source.Name(), err)
+		}
+	}
+	reasons := make([]string, len(trace))
+	for i, attempt := range trace {
+		reasons[i] = fmt.Sprintf("%s: %v", attempt.Source, attempt.Err)
+	}
+	return ConnectionParameters{}, trace, fmt.Errorf("%w (%s)", ErrNoConnection, strings.Join(reasons, "; "))
+}
+
+// DefaultConnectionSources returns the usual resolution chain: the explicit connection parameters if not nil, the
+// files listed in KUBECONFIG, ~/.kube/config, and finally the in-cluster service account.
+func DefaultConnectionSources(explicit *ConnectionParameters) []ConnectionSource {
+	return []ConnectionSource{
+		ExplicitSource(explicit),
+		KubeConfigEnvSource(KubeConfigConnectionOptions{}),
+		HomeKubeConfigSource(KubeConfigConnectionOptions{}),
+		InClusterSource(InClusterOptions{}),
+	}
+}
+
+// NewConnectionSource creates a connection source from a function.
+func NewConnectionSource(name string, resolve func(ctx context.Context) (ConnectionParameters, error)) ConnectionSource {
+	return &funcConnectionSource{name: name, resolve: resolve}
+}
+
+type funcConnectionSource struct {
+	name    string
+	resolve func(ctx context.Context) (ConnectionParameters, error)
+}
+
+func (f *funcConnectionSource) Name() string {
+	return f.name
+}
+
+func (f *funcConnectionSource) Resolve(ctx context.Context) (ConnectionParameters, error) {
+	return f.resolve(ctx)
+}
+
+// ExplicitSource provides the given connection parameters. It is unavailable if the parameters are nil.
+func ExplicitSource(connection *ConnectionParameters) ConnectionSource {
+	return NewConnectionSource("explicit", func(_ context.Context) (ConnectionParameters, error) {
+		if connection == nil {
+			return ConnectionParameters{}, fmt.Errorf("%w: no connection parameters given", ErrSourceUnavailable)
+		}
+		if err := ConnectionParametersSchema().Validate(*connection); err != nil {
+			return ConnectionParameters{}, err
+		}
+		return *connection, nil
+	})
+}
+
+// KubeConfigEnvSource converts the kubeconfig files listed in the KUBECONFIG environment variable. It is unavailable
+// if the variable is unset or none of the files exist.
+func KubeConfigEnvSource(opts KubeConfigConnectionOptions) ConnectionSource {
+	return NewConnectionSource(KubeConfigEnv, func(_ context.Context) (ConnectionParameters, error) {
+		kubeconfig, err := LoadKubeConfigFromEnv()
+		if err != nil {
+			if errors.Is(err, ErrKubeConfigNotFound) {
+				return ConnectionParameters{}, fmt.Errorf("%w: %w", ErrSourceUnavailable, err)
+			}
+			return ConnectionParameters{}, err
+		}
+		connection, _, err := KubeConfigToConnectionForContext(kubeconfig, "", opts)
+		return connection, err
+	})
+}
+
+// KubeConfigFileSource converts the kubeconfig file at the given path. It is unavailable if the file does not exist.
+func KubeConfigFileSource(path string, opts KubeConfigConnectionOptions) ConnectionSource {
+	return NewConnectionSource(path, func(_ context.Context) (ConnectionParameters, error) {
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return ConnectionParameters{}, fmt.Errorf("%w: %w", ErrSourceUnavailable, err)
+			}
+			return ConnectionParameters{}, err
+		}
+		kubeconfig, err := LoadKubeConfigFiles(path)
+		if err != nil {
+			return ConnectionParameters{}, err
+		}
+		connection, _, err := KubeConfigToConnectionForContext(kubeconfig, "", opts)
+		return connection, err
+	})
+}
+
+// HomeKubeConfigSource converts ~/.kube/config. It is unavailable if the file or the home directory does not exist.
+func HomeKubeConfigSource(opts KubeConfigConnectionOptions) ConnectionSource {
+	const name = "~/.kube/config"
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return NewConnectionSource(name, func(_ context.Context) (ConnectionParameters, error) {
+			return ConnectionParameters{}, fmt.Errorf("%w: %w", ErrSourceUnavailable, err)
+		})
+	}
+	source := KubeConfigFileSource(filepath.Join(home, ".kube", "config"), opts)
+	return NewConnectionSource(name, source.Resolve)
+}
+
+// InClusterSource builds the connection from the service account of the pod the process runs in. It is unavailable
+// outside a cluster.
+func InClusterSource(opts InClusterOptions) ConnectionSource {
+	return NewConnectionSource("in-cluster", func(_ context.Context) (ConnectionParameters, error) {
+		connection, _, err := InClusterConnection(opts)
+		if errors.Is(err, ErrNotInCluster) {
+			return ConnectionParameters{}, fmt.Errorf("%w: %w", ErrSourceUnavailable, err)
+		}
+		return connection, err
+	})
+}
@@ -0,0 +1,78 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveConnection(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(KubeConfigEnv, "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	explicit := ConnectionParameters{Host: "explicit.example.com:6443", BearerToken: "token"}
+	connection, trace, err := ResolveConnection(context.Background(), DefaultConnectionSources(&explicit)...)
+	assert.Nil(t, err)
+	assert.Equal(t, explicit, connection)
+	assert.Equal(t, 1, len(trace))
+	assert.True(t, trace[0].Selected)
+
+	// test falling through to ~/.kube/config
+	assert.Nil(t, os.MkdirAll(filepath.Join(home, ".kube"), 0700))
+	kubeconfig, err := os.ReadFile(filepath.Join("testdata", "kubeconfig-data.yaml"))
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(home, ".kube", "config"), kubeconfig, 0600))
+	connection, trace, err = ResolveConnection(context.Background(), DefaultConnectionSources(nil)...)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:6443", connection.Host)
+	assert.Equal(t, 3, len(trace))
+	assert.Equal(t, "explicit", trace[0].Source)
+	assert.True(t, errors.Is(trace[0].Err, ErrSourceUnavailable))
+	assert.Equal(t, KubeConfigEnv, trace[1].Source)
+	assert.True(t, errors.Is(trace[1].Err, ErrKubeConfigNotFound))
+	assert.Equal(t, "~/.kube/config", trace[2].Source)
+	assert.True(t, trace[2].Selected)
+
+	// test that KUBECONFIG takes precedence over ~/.kube/config
+	t.Setenv(KubeConfigEnv, filepath.Join("testdata", "kubeconfig-multicontext.yaml"))
+	connection, trace, err = ResolveConnection(context.Background(), DefaultConnectionSources(nil)...)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(trace))
+	assert.True(t, trace[1].Selected)
+	assert.Equal(t, "sha256~developer", connection.BearerToken)
+}
+
+func TestResolveConnectionFailure(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	missing := KubeConfigFileSource(filepath.Join(t.TempDir(), "missing.yaml"), KubeConfigConnectionOptions{})
+
+	// test the error and trace when no source is available
+	_, trace, err := ResolveConnection(context.Background(), missing, InClusterSource(InClusterOptions{}))
+	assert.True(t, errors.Is(err, ErrNoConnection))
+	assert.Equal(t, 2, len(trace))
+	assert.True(t, errors.Is(trace[0].Err, os.ErrNotExist))
+	assert.True(t, errors.Is(trace[1].Err, ErrNotInCluster))
+
+	// test that a broken source stops the resolution
+	broken := KubeConfigFileSource(filepath.Join("testdata", "kubeconfig-nocontext.yaml"), KubeConfigConnectionOptions{})
+	unreachable := NewConnectionSource("unreachable", func(_ context.Context) (ConnectionParameters, error) {
+		t.Fatal("source after a broken source was tried")
+		return ConnectionParameters{}, nil
+	})
+	_, trace, err = ResolveConnection(context.Background(), missing, broken, unreachable)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrNoConnection))
+	assert.Equal(t, 2, len(trace))
+
+	// test cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, trace, err = ResolveConnection(ctx, unreachable)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 0, len(trace))
+}
@@ -0,0 +1,216 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ServerCASource describes where FetchServerCA found the CA certificate.
+type ServerCASource string
+
+const (
+	// ServerCASourceChain means the server presented the self-signed root of its chain.
+	ServerCASourceChain ServerCASource = "chain"
+	// ServerCASourceClusterInfo means the root was read from the cluster-info ConfigMap in the kube-public namespace,
+	// which kubeadm clusters publish to anonymous users, and it was verified to sign the presented chain.
+	ServerCASourceClusterInfo ServerCASource = "cluster-info"
+	// ServerCASourcePresented means no root was available and the last certificate presented by the server is
+	// trusted instead. The connection then has to be updated when that certificate is renewed.
+	ServerCASourcePresented ServerCASource = "presented"
+)
+
+// clusterInfoPath is the path of the kubeadm cluster-info ConfigMap.
+const clusterInfoPath = "/api/v1/namespaces/kube-public/configmaps/cluster-info"
+
+// ServerCA is the result of FetchServerCA.
+type ServerCA struct {
+	// Chain holds the certificates presented by the server, starting with the server certificate.
+	Chain []*x509.Certificate
+	// CA is the certificate the connection trusts.
+	CA     *x509.Certificate
+	Source ServerCASource
+	// Fingerprint is the SHA-256 fingerprint of the CA certificate in the colon-separated format openssl prints. It
+	// must be confirmed by the operator, for example against the output of
+	// openssl x509 -noout -fingerprint -sha256 -in /etc/kubernetes/pki/ca.crt on a control plane node.
+	Fingerprint string
+	// Connection connects to the host trusting only the CA.
+	Connection ConnectionParameters
+}
+
+// FetchServerCA retrieves the CA of the API server at the host without verifying it, so a connection can trust it
+// instead of disabling TLS verification. This is only as safe as the network path during the first connection: the
+// fingerprint must be confirmed out of band before the returned connection is used. The server is dialed directly,
+// proxies are not used.
+func FetchServerCA(ctx context.Context, host string) (*ServerCA, error) {
+	connectionHost, err := serverToHost(host)
+	if err != nil {
+		return nil, err
+	}
+	server, err := hostToServer(connectionHost)
+	if err != nil {
+		return nil, err
+	}
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	if serverURL.Scheme != "https" {
+		return nil, fmt.Errorf("the server %s does not use TLS", serverURL)
+	}
+	port := serverURL.Port()
+	if port == "" {
+		port = "443"
+	}
+	address := net.JoinHostPort(serverURL.Hostname(), port)
+
+	var chain []*x509.Certificate
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverURL.Hostname(),
+		// The chain is not trusted yet, it is returned for the operator to confirm.
+		InsecureSkipVerify: true, //nolint:gosec // Trust on first use, see above.
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if chain == nil {
+				chain = state.PeerCertificates
+				return nil
+			}
+			// Later connections must present the same server certificate as the first one.
+			if len(state.PeerCertificates) == 0 || !state.PeerCertificates[0].Equal(chain[0]) {
+				return errors.New("the server presented a different certificate than on the first connection")
+			}
+			return nil
+		},
+	}
+	conn, err := (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s (%w)", address, err)
+	}
+	_ = conn.Close()
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("the server %s did not present a certificate", address)
+	}
+
+	result := &ServerCA{Chain: chain}
+	last := chain[len(chain)-1]
+	clusterInfoURL := serverURL.Scheme + "://" + serverURL.Host + path.Join(serverURL.Path, clusterInfoPath)
+	if last.IsCA && last.CheckSignatureFrom(last) == nil {
+		result.CA = last
+		result.Source = ServerCASourceChain
+	} else if ca := clusterInfoIssuer(ctx, clusterInfoURL, tlsConfig, chain); ca != nil {
+		result.CA = ca
+		result.Source = ServerCASourceClusterInfo
+	} else {
+		result.CA = last
+		result.Source = ServerCASourcePresented
+	}
+	result.Fingerprint = certificateFingerprint(result.CA)
+	result.Connection = ConnectionParameters{
+		Host:   connectionHost,
+		CAData: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: result.CA.Raw})),
+	}
+	return result, nil
+}
+
+// clusterInfoIssuer returns the CA of the cluster-info ConfigMap that issued the chain, or nil if there is none. The
+// ConfigMap holds several CAs while the cluster CA is rotated.
+func clusterInfoIssuer(
+	ctx context.Context,
+	clusterInfoURL string,
+	tlsConfig *tls.Config,
+	chain []*x509.Certificate,
+) *x509.Certificate {
+	cas, err := fetchClusterInfoCAs(ctx, clusterInfoURL, tlsConfig)
+	if err != nil {
+		return nil
+	}
+	for _, ca := range cas {
+		if certificateIssuedBy(chain[0], chain[1:], []*x509.Certificate{ca}) {
+			return ca
+		}
+	}
+	return nil
+}
+
+// fetchClusterInfoCAs reads the CAs from the kubeconfig in the cluster-info ConfigMap.
+func fetchClusterInfoCAs(
+	ctx context.Context,
+	clusterInfoURL string,
+	tlsConfig *tls.Config,
+) ([]*x509.Certificate, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	defer client.CloseIdleConnections()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, clusterInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cluster-info (%w)", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query cluster-info: %s", response.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster-info (%w)", err)
+	}
+	var configMap struct {
+		Data struct {
+			KubeConfig string `json:"kubeconfig"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &configMap); err != nil {
+		return nil, fmt.Errorf("failed to decode cluster-info (%w)", err)
+	}
+	// The kubeconfig is decoded leniently, as only the CA is of interest.
+	var kubeconfig struct {
+		Clusters []struct {
+			Cluster struct {
+				CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			} `yaml:"cluster"`
+		} `yaml:"clusters"`
+	}
+	if err := yaml.Unmarshal([]byte(configMap.Data.KubeConfig), &kubeconfig); err != nil {
+		return nil, fmt.Errorf("failed to decode the cluster-info kubeconfig (%w)", err)
+	}
+	if len(kubeconfig.Clusters) == 0 {
+		return nil, errors.New("no cluster in the cluster-info kubeconfig")
+	}
+	caData, err := base64.StdEncoding.DecodeString(kubeconfig.Clusters[0].Cluster.CertificateAuthorityData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA data in the cluster-info kubeconfig (%w)", err)
+	}
+	certs, err := parseCertificatesPEM(caData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA data in the cluster-info kubeconfig (%w)", err)
+	}
+	return certs, nil
+}
+
+// certificateFingerprint returns the SHA-256 fingerprint of the certificate as colon-separated upper case hex bytes.
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
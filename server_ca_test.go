@@ -0,0 +1,86 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchServerCA(t *testing.T) {
+	root := newTestIssuer(t, "root-ca", nil)
+	validUntil := time.Now().Add(time.Hour)
+	clusterInfo := ""
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/version":
+			_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+		case r.URL.Path == clusterInfoPath && clusterInfo != "":
+			kubeconfig := "apiVersion: v1\nkind: Config\nclusters:\n- name: \"\"\n  cluster:\n" +
+				"    certificate-authority-data: " + clusterInfo + "\n    server: https://127.0.0.1:6443\n"
+			data, _ := json.Marshal(map[string]any{"data": map[string]string{"kubeconfig": kubeconfig}})
+			_, _ = w.Write(data)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	// test a server presenting its root
+	server := newTestTLSServerWithHandler(t, handler, root, validUntil, root.cert)
+	serverCA, err := FetchServerCA(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, ServerCASourceChain, serverCA.Source)
+	assert.True(t, serverCA.CA.Equal(root.cert))
+	assert.Len(t, serverCA.Chain, 2)
+	sum := sha256.Sum256(root.cert.Raw)
+	assert.Equal(t, strings.ToUpper(hex.EncodeToString(sum[:])), strings.ReplaceAll(serverCA.Fingerprint, ":", ""))
+	assert.Equal(t, strings.TrimPrefix(server.URL, "https://"), serverCA.Connection.Host)
+	assert.False(t, serverCA.Connection.Insecure)
+
+	// test that the pinned connection verifies the server
+	client, err := Client(serverCA.Connection)
+	assert.Nil(t, err)
+	version, err := client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.33.2", version.GitVersion)
+
+	// test that the presented certificate is trusted if the cluster-info CA did not issue it
+	server = newTestTLSServerWithHandler(t, handler, root, validUntil)
+	host := strings.TrimPrefix(server.URL, "https://")
+	other := newTestIssuer(t, "other-ca", nil)
+	clusterInfo = base64.StdEncoding.EncodeToString([]byte(certificatePEM(other.cert)))
+	serverCA, err = FetchServerCA(context.Background(), host)
+	assert.Nil(t, err)
+	assert.Equal(t, ServerCASourcePresented, serverCA.Source)
+	assert.True(t, serverCA.CA.Equal(serverCA.Chain[0]))
+
+	// test that the root is taken from cluster-info if the server only presents its certificate
+	clusterInfo = base64.StdEncoding.EncodeToString([]byte(certificatePEM(root.cert)))
+	serverCA, err = FetchServerCA(context.Background(), host)
+	assert.Nil(t, err)
+	assert.Equal(t, ServerCASourceClusterInfo, serverCA.Source)
+	assert.True(t, serverCA.CA.Equal(root.cert))
+	client, err = Client(serverCA.Connection)
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+
+	// test that the issuing root is found in a cluster-info bundle holding the old and new CA during a rotation
+	clusterInfo = base64.StdEncoding.EncodeToString([]byte(certificatePEM(other.cert) + certificatePEM(root.cert)))
+	serverCA, err = FetchServerCA(context.Background(), host)
+	assert.Nil(t, err)
+	assert.Equal(t, ServerCASourceClusterInfo, serverCA.Source)
+	assert.True(t, serverCA.CA.Equal(root.cert))
+	assert.Equal(t, certificateFingerprint(root.cert), serverCA.Fingerprint)
+	assert.Equal(t, certificatePEM(root.cert), serverCA.Connection.CAData)
+
+	_, err = FetchServerCA(context.Background(), "http://127.0.0.1:8080")
+	assert.ErrorContains(t, err, "does not use TLS")
+}
@@ -0,0 +1,107 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+)
+
+// pinnedSPKIExtensionName is the name of the kubeconfig cluster extension ConnectionToKubeConfig stores the pinned
+// public keys in. Kubectl ignores the extension, so it does not enforce the pins.
+const pinnedSPKIExtensionName = "arcaflow.io/pinned-spki-sha256"
+
+// SPKISHA256 returns the pin of the certificate for the pinnedSPKISHA256 connection property: the base64 encoded
+// SHA-256 hash of its subject public key info. Unlike the certificate fingerprint, it stays the same when the
+// certificate is renewed with the same key.
+func SPKISHA256(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyPinnedSPKI returns a tls.Config.VerifyConnection function that fails the handshake unless the server
+// certificate chain contains a certificate with one of the pinned public keys. Only the chains verified against the
+// CAs are considered, as the server can present any certificate alongside its own. If verification is skipped, only
+// the server certificate is matched, since the handshake proves the server holds its key.
+func verifyPinnedSPKI(pins []string) func(tls.ConnectionState) error {
+	pinned := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		pinned[pin] = true
+	}
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return &PinnedSPKIMismatchError{}
+		}
+		candidates := []*x509.Certificate{state.PeerCertificates[0]}
+		for _, chain := range state.VerifiedChains {
+			candidates = append(candidates, chain...)
+		}
+		for _, cert := range candidates {
+			if pinned[SPKISHA256(cert)] {
+				return nil
+			}
+		}
+		return &PinnedSPKIMismatchError{Subject: state.PeerCertificates[0].Subject.String()}
+	}
+}
+
+// pinnedSPKIExtension returns the kubeconfig cluster extension holding the pins.
+func pinnedSPKIExtension(pins []string) map[string]any {
+	values := make([]any, len(pins))
+	for i, pin := range pins {
+		values[i] = pin
+	}
+	return map[string]any{
+		"name":      pinnedSPKIExtensionName,
+		"extension": map[string]any{"pins": values},
+	}
+}
+
+// pinnedSPKIFromExtensions reads the pins from the extensions of a kubeconfig cluster, or returns nil if there is no
+// pinning extension. Other extensions are ignored.
+func pinnedSPKIFromExtensions(extensions any) (*[]string, error) {
+	list, ok := extensions.([]any)
+	if !ok {
+		return nil, nil
+	}
+	for _, item := range list {
+		entry := stringKeyedMap(item)
+		if entry == nil || entry["name"] != pinnedSPKIExtensionName {
+			continue
+		}
+		extension := stringKeyedMap(entry["extension"])
+		values, ok := extension["pins"].([]any)
+		if !ok {
+			return nil, errors.New("invalid " + pinnedSPKIExtensionName + " extension, expected a list of pins")
+		}
+		pins := make([]string, len(values))
+		for i, value := range values {
+			pin, ok := value.(string)
+			if !ok {
+				return nil, errors.New("invalid " + pinnedSPKIExtensionName + " extension, expected a list of pins")
+			}
+			pins[i] = pin
+		}
+		return &pins, nil
+	}
+	return nil, nil
+}
+
+// stringKeyedMap returns the value as a map with string keys, or nil if it is not a map. YAML decoders produce maps
+// with interface keys.
+func stringKeyedMap(value any) map[string]any {
+	switch typed := value.(type) {
+	case map[string]any:
+		return typed
+	case map[any]any:
+		result := make(map[string]any, len(typed))
+		for key, item := range typed {
+			if name, ok := key.(string); ok {
+				result[name] = item
+			}
+		}
+		return result
+	}
+	return nil
+}
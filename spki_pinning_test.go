@@ -0,0 +1,99 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPinnedSPKI(t *testing.T) {
+	root := newTestIssuer(t, "root-ca", nil)
+	intermediate := newTestIssuer(t, "intermediate-ca", root)
+	other := newTestIssuer(t, "other-ca", nil)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	})
+	server := newTestTLSServerWithHandler(t, handler, intermediate, time.Now().Add(time.Hour), intermediate.cert)
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	serverVersion := func(connection ConnectionParameters) error {
+		client, err := Client(connection)
+		if err != nil {
+			return err
+		}
+		_, err = client.Discovery().ServerVersion()
+		return err
+	}
+	pinned := func(insecure bool, pins ...string) ConnectionParameters {
+		connection := ConnectionParameters{Host: host, Insecure: insecure, PinnedSPKISHA256: &pins}
+		if !insecure {
+			connection.CAData = certificatePEM(root.cert)
+		}
+		return connection
+	}
+
+	// test that any certificate of the verified chain can be pinned
+	assert.Nil(t, serverVersion(pinned(false, SPKISHA256(root.cert))))
+	assert.Nil(t, serverVersion(pinned(false, SPKISHA256(intermediate.cert))))
+	assert.Nil(t, serverVersion(pinned(false, SPKISHA256(other.cert), SPKISHA256(server.Certificate()))))
+
+	// test that a chain issued by the CA is rejected if it does not contain a pinned key
+	err := serverVersion(pinned(false, SPKISHA256(other.cert)))
+	mismatch := &PinnedSPKIMismatchError{}
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, "CN=kube-apiserver", mismatch.Subject)
+
+	// test that only the server certificate is matched if verification is skipped
+	assert.Nil(t, serverVersion(pinned(true, SPKISHA256(server.Certificate()))))
+	assert.ErrorAs(t, serverVersion(pinned(true, SPKISHA256(intermediate.cert))), &mismatch)
+
+	// test that the pins are enforced together with the token file wrapper
+	connection := pinned(false, SPKISHA256(other.cert))
+	connection.BearerTokenFile = "testdata/tokenfile"
+	assert.ErrorAs(t, serverVersion(connection), &mismatch)
+
+	// test that the TLS stage of the connection check enforces the pins
+	report, err := CheckConnection(context.Background(), pinned(false, SPKISHA256(other.cert)))
+	assert.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, ConnectionCheckStageTLS, report.FailedStage)
+
+	// test that pins are rejected for plain HTTP servers
+	_, err = ConnectionToRestConfig(ConnectionParameters{
+		Host:             "http://127.0.0.1:8080",
+		PinnedSPKISHA256: &[]string{SPKISHA256(root.cert)},
+	})
+	assert.ErrorContains(t, err, "require a TLS connection")
+}
+
+func TestPinnedSPKIKubeConfigRoundTrip(t *testing.T) {
+	pins := []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", "cGlubmVkLXB1YmxpYy1rZXktc2hhMjU2LWhhc2gxMjM="}
+	kubeconfig, err := ConnectionToKubeConfig(ConnectionParameters{Host: "127.0.0.1:6443", PinnedSPKISHA256: &pins})
+	assert.Nil(t, err)
+
+	builder := &strings.Builder{}
+	assert.Nil(t, WriteKubeConfig(builder, kubeconfig))
+	assert.Contains(t, builder.String(), pinnedSPKIExtensionName)
+	parsed, err := ParseKubeConfig(builder.String())
+	assert.Nil(t, err)
+	connection, err := KubeConfigToConnection(parsed, false)
+	assert.Nil(t, err)
+	assert.Equal(t, &pins, connection.PinnedSPKISHA256)
+
+	// test that other extensions do not enable pinning
+	parsed.Clusters[0].Cluster.Extensions = []any{map[string]any{"name": "minikube", "extension": map[string]any{}}}
+	connection, err = KubeConfigToConnection(parsed, false)
+	assert.Nil(t, err)
+	assert.Nil(t, connection.PinnedSPKISHA256)
+
+	parsed.Clusters[0].Cluster.Extensions = []any{map[string]any{
+		"name":      pinnedSPKIExtensionName,
+		"extension": map[string]any{"pins": "not a list"},
+	}}
+	_, err = KubeConfigToConnection(parsed, false)
+	assert.ErrorContains(t, err, "expected a list of pins")
+}
@@ -0,0 +1,284 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// TLSProblemKind classifies a problem found by DiagnoseTLS.
+type TLSProblemKind string
+
+const (
+	// TLSProblemHandshake means the TLS handshake failed, for example because the server rejected the client
+	// certificate.
+	TLSProblemHandshake TLSProblemKind = "handshake"
+	// TLSProblemHostnameMismatch means the server certificate is not valid for the host or server name.
+	TLSProblemHostnameMismatch TLSProblemKind = "hostname-mismatch"
+	// TLSProblemUnknownAuthority means the server certificate is not issued by any of the configured CAs.
+	TLSProblemUnknownAuthority TLSProblemKind = "unknown-authority"
+	// TLSProblemMissingIntermediate means the chain presented by the server stops at an intermediate certificate
+	// whose issuer is neither presented nor configured as a CA.
+	TLSProblemMissingIntermediate TLSProblemKind = "missing-intermediate"
+	// TLSProblemExpired means a certificate of the chain or a configured CA is outside its validity window.
+	TLSProblemExpired TLSProblemKind = "expired"
+)
+
+// TLSProblem is a single reason why the server certificate fails verification.
+type TLSProblem struct {
+	Kind    TLSProblemKind
+	Message string
+}
+
+// TLSDiagnosis is the result of DiagnoseTLS. It holds the chain presented by the server and the problems found when
+// verifying it against the CAs and the server name of the connection. No problems means that the verification
+// succeeds.
+type TLSDiagnosis struct {
+	Address string
+	// ServerName is the name the server certificate is verified against, either the serverName of the connection or
+	// the host.
+	ServerName string
+	// Chain holds the certificates presented by the server, starting with the server certificate.
+	Chain []*x509.Certificate
+	// CASource describes where the CAs were taken from: the cacert field, the cacertFile path or the system roots.
+	CASource string
+	// CASubjects holds the subjects of the configured CAs. It is empty if the system roots are used.
+	CASubjects []string
+	Problems   []TLSProblem
+}
+
+// String returns a human-readable description of the diagnosis.
+func (d *TLSDiagnosis) String() string {
+	builder := &strings.Builder{}
+	_, _ = fmt.Fprintf(builder, "TLS diagnosis for %s (server name %s)\n", d.Address, d.ServerName)
+	_, _ = fmt.Fprintf(builder, "Certificate authorities from %s:\n", d.CASource)
+	for _, subject := range d.CASubjects {
+		_, _ = fmt.Fprintf(builder, "  - %s\n", subject)
+	}
+	_, _ = fmt.Fprintf(builder, "Presented chain:\n")
+	for i, cert := range d.Chain {
+		_, _ = fmt.Fprintf(builder, "  %d. %s, issued by %s, valid %s to %s\n", i, cert.Subject.String(),
+			cert.Issuer.String(), cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		if i == 0 {
+			_, _ = fmt.Fprintf(builder, "     names: %s\n", strings.Join(certificateNames(cert), ", "))
+		}
+	}
+	if len(d.Problems) == 0 {
+		_, _ = fmt.Fprintf(builder, "No problems found.\n")
+	}
+	for _, problem := range d.Problems {
+		_, _ = fmt.Fprintf(builder, "Problem (%s): %s\n", problem.Kind, problem.Message)
+	}
+	return builder.String()
+}
+
+// DiagnoseTLS dials the server of the connection, captures the certificate chain it presents and explains why the
+// chain would fail verification: names that don't match the host or server name, issuers that don't match the
+// configured CAs, certificates outside their validity window and missing intermediates. The server is dialed
+// directly, proxies are not used. An error is returned if the server cannot be reached or does not use TLS.
+func DiagnoseTLS(ctx context.Context, connection ConnectionParameters) (*TLSDiagnosis, error) {
+	config, err := ConnectionToRestConfig(connection)
+	if err != nil {
+		return nil, err
+	}
+	serverURL, _, err := restclient.DefaultServerUrlFor(config)
+	if err != nil {
+		return nil, err
+	}
+	if serverURL.Scheme != "https" {
+		return nil, fmt.Errorf("the server %s does not use TLS", serverURL)
+	}
+	port := serverURL.Port()
+	if port == "" {
+		port = "443"
+	}
+	diagnosis := &TLSDiagnosis{
+		Address:    net.JoinHostPort(serverURL.Hostname(), port),
+		ServerName: config.ServerName,
+	}
+	if diagnosis.ServerName == "" {
+		diagnosis.ServerName = serverURL.Hostname()
+	}
+
+	roots, err := diagnosis.loadCAs(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := restclient.TLSConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	tlsConfig.ServerName = diagnosis.ServerName
+	// The chain is verified below to explain failures, so the handshake must not abort on them. It is captured
+	// before the server checks the client certificate, so a rejected client certificate does not hide it.
+	tlsConfig.InsecureSkipVerify = true //nolint:gosec // The chain is verified by DiagnoseTLS itself.
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		diagnosis.Chain = state.PeerCertificates
+		return nil
+	}
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, handshakeErr := dialer.DialContext(ctx, "tcp", diagnosis.Address)
+	if handshakeErr == nil {
+		_ = conn.Close()
+	}
+	if len(diagnosis.Chain) == 0 {
+		if handshakeErr != nil {
+			return nil, fmt.Errorf("failed to connect to %s (%w)", diagnosis.Address, handshakeErr)
+		}
+		return nil, fmt.Errorf("the server %s did not present a certificate", diagnosis.Address)
+	}
+	if handshakeErr != nil {
+		diagnosis.report(TLSProblemHandshake, "the TLS handshake failed after the server presented its certificate "+
+			"(%s), check the client certificate and key", handshakeErr.Error())
+	}
+
+	diagnosis.checkHostname(connection.ServerName != "")
+	diagnosis.checkValidity(time.Now())
+	diagnosis.checkIssuer(roots, time.Now())
+	return diagnosis, nil
+}
+
+func (d *TLSDiagnosis) report(kind TLSProblemKind, format string, args ...any) {
+	d.Problems = append(d.Problems, TLSProblem{Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// loadCAs returns the configured CAs, or nil to use the system roots.
+func (d *TLSDiagnosis) loadCAs(config *restclient.Config) (*x509.CertPool, error) {
+	var data []byte
+	switch {
+	case len(config.CAData) > 0:
+		d.CASource = "cacert"
+		data = config.CAData
+	case config.CAFile != "":
+		d.CASource = "cacertFile " + config.CAFile
+		fileData, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, &CredentialFileError{Path: config.CAFile, Err: err}
+		}
+		data = fileData
+	default:
+		d.CASource = "the system roots"
+		return nil, nil
+	}
+	cas, err := parseCertificatesPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA certificate in %s (%w)", d.CASource, err)
+	}
+	pool := x509.NewCertPool()
+	for _, ca := range cas {
+		pool.AddCert(ca)
+		d.CASubjects = append(d.CASubjects, ca.Subject.String())
+		if time.Now().After(ca.NotAfter) {
+			d.report(TLSProblemExpired, "the CA %s from %s expired on %s", ca.Subject.String(), d.CASource,
+				ca.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return pool, nil
+}
+
+func (d *TLSDiagnosis) checkHostname(serverNameSet bool) {
+	leaf := d.Chain[0]
+	if leaf.VerifyHostname(d.ServerName) == nil {
+		return
+	}
+	field := "host"
+	if serverNameSet {
+		field = "serverName"
+	}
+	d.report(TLSProblemHostnameMismatch, "the server certificate is valid for %s, but not for the %s %s; set "+
+		"serverName to one of the names the certificate is valid for", strings.Join(certificateNames(leaf), ", "),
+		field, d.ServerName)
+}
+
+func (d *TLSDiagnosis) checkValidity(now time.Time) {
+	for _, cert := range d.Chain {
+		switch {
+		case now.Before(cert.NotBefore):
+			d.report(TLSProblemExpired, "the certificate %s is not valid before %s", cert.Subject.String(),
+				cert.NotBefore.Format(time.RFC3339))
+		case now.After(cert.NotAfter):
+			d.report(TLSProblemExpired, "the certificate %s expired on %s", cert.Subject.String(),
+				cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// checkIssuer verifies the chain against the CAs. Validity periods are ignored here, as they are reported by
+// checkValidity, so the chain is verified at a time at which the server certificate is valid.
+func (d *TLSDiagnosis) checkIssuer(roots *x509.CertPool, now time.Time) {
+	leaf := d.Chain[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range d.Chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	verifyTime := now
+	if verifyTime.After(leaf.NotAfter) {
+		verifyTime = leaf.NotAfter
+	} else if verifyTime.Before(leaf.NotBefore) {
+		verifyTime = leaf.NotBefore
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   verifyTime,
+	})
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case err == nil:
+		return
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		// Reported by checkValidity and loadCAs.
+		return
+	case !errors.As(err, &unknownAuthority):
+		d.report(TLSProblemUnknownAuthority, "the server certificate chain is not trusted (%s)", err.Error())
+		return
+	}
+
+	last := d.Chain[len(d.Chain)-1]
+	cas := "the system roots"
+	if len(d.CASubjects) > 0 {
+		cas = strings.Join(d.CASubjects, ", ")
+	}
+	for _, subject := range d.CASubjects {
+		if subject == last.Issuer.String() {
+			d.report(TLSProblemUnknownAuthority, "the certificate %s is issued by %s, and a CA of that name is "+
+				"configured in %s, but its key does not match; the CA was likely rotated, update %s",
+				last.Subject.String(), last.Issuer.String(), d.CASource, d.CASource)
+			return
+		}
+	}
+	if last.CheckSignatureFrom(last) == nil || last.Subject.String() == last.Issuer.String() {
+		d.report(TLSProblemUnknownAuthority, "the server certificate chain ends with %s, which is not one of the "+
+			"CAs from %s (%s); configure the CA of the cluster in cacert or cacertFile", last.Subject.String(),
+			d.CASource, cas)
+		return
+	}
+	d.report(TLSProblemMissingIntermediate, "the server certificate chain ends with %s, issued by %s, which is "+
+		"neither presented by the server nor one of the CAs from %s (%s); either the server does not send its "+
+		"intermediate certificates or the CA is wrong", last.Subject.String(), last.Issuer.String(), d.CASource, cas)
+}
+
+// certificateNames returns the DNS names and IP addresses a certificate is valid for.
+func certificateNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 {
+		names = append(names, "no names")
+	}
+	return names
+}
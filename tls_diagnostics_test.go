@@ -0,0 +1,89 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"context"
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func diagnoseTestServer(t *testing.T, server *httptest.Server, ca *x509.Certificate, serverName string) *TLSDiagnosis {
+	diagnosis, err := DiagnoseTLS(context.Background(), ConnectionParameters{
+		Host:       strings.TrimPrefix(server.URL, "https://"),
+		CAData:     certificatePEM(ca),
+		ServerName: serverName,
+	})
+	assert.Nil(t, err)
+	return diagnosis
+}
+
+func problemKinds(diagnosis *TLSDiagnosis) []TLSProblemKind {
+	var kinds []TLSProblemKind
+	for _, problem := range diagnosis.Problems {
+		kinds = append(kinds, problem.Kind)
+	}
+	return kinds
+}
+
+func TestDiagnoseTLS(t *testing.T) {
+	root := newTestIssuer(t, "root-ca", nil)
+	intermediate := newTestIssuer(t, "intermediate-ca", root)
+	validUntil := time.Now().Add(time.Hour)
+
+	// test that a valid chain has no problems
+	server := newTestTLSServer(t, root, validUntil)
+	diagnosis := diagnoseTestServer(t, server, root.cert, "")
+	assert.Empty(t, diagnosis.Problems)
+	assert.Equal(t, "127.0.0.1", diagnosis.ServerName)
+	assert.Equal(t, "cacert", diagnosis.CASource)
+	assert.Equal(t, []string{"CN=root-ca"}, diagnosis.CASubjects)
+	assert.Len(t, diagnosis.Chain, 1)
+	assert.Contains(t, diagnosis.String(), "No problems found.")
+
+	// test a server name the certificate is not valid for
+	diagnosis = diagnoseTestServer(t, server, root.cert, "kubernetes.default.svc")
+	assert.Equal(t, []TLSProblemKind{TLSProblemHostnameMismatch}, problemKinds(diagnosis))
+	assert.Contains(t, diagnosis.Problems[0].Message, "kubernetes.local, 127.0.0.1")
+	assert.Contains(t, diagnosis.Problems[0].Message, "serverName kubernetes.default.svc")
+	diagnosis = diagnoseTestServer(t, server, root.cert, "kubernetes.local")
+	assert.Empty(t, diagnosis.Problems)
+
+	// test a CA that did not issue the server certificate
+	other := newTestIssuer(t, "other-ca", nil)
+	diagnosis = diagnoseTestServer(t, server, other.cert, "")
+	assert.Equal(t, []TLSProblemKind{TLSProblemMissingIntermediate}, problemKinds(diagnosis))
+	selfSigned := newTestIssuer(t, "self-signed", nil)
+	selfSignedServer := newTestTLSServer(t, selfSigned, validUntil, selfSigned.cert)
+	diagnosis = diagnoseTestServer(t, selfSignedServer, other.cert, "")
+	assert.Equal(t, []TLSProblemKind{TLSProblemUnknownAuthority}, problemKinds(diagnosis))
+	assert.Contains(t, diagnosis.Problems[0].Message, "ends with CN=self-signed")
+
+	// test a rotated CA with the same name
+	rotated := newTestIssuer(t, "root-ca", nil)
+	diagnosis = diagnoseTestServer(t, server, rotated.cert, "")
+	assert.Equal(t, []TLSProblemKind{TLSProblemUnknownAuthority}, problemKinds(diagnosis))
+	assert.Contains(t, diagnosis.Problems[0].Message, "the CA was likely rotated")
+
+	// test a server that does not send its intermediate certificate
+	server = newTestTLSServer(t, intermediate, validUntil)
+	diagnosis = diagnoseTestServer(t, server, root.cert, "")
+	assert.Equal(t, []TLSProblemKind{TLSProblemMissingIntermediate}, problemKinds(diagnosis))
+	assert.Contains(t, diagnosis.Problems[0].Message, "issued by CN=intermediate-ca")
+	server = newTestTLSServer(t, intermediate, validUntil, intermediate.cert)
+	diagnosis = diagnoseTestServer(t, server, root.cert, "")
+	assert.Empty(t, diagnosis.Problems)
+	assert.Len(t, diagnosis.Chain, 2)
+
+	// test an expired server certificate
+	server = newTestTLSServer(t, root, time.Now().Add(-time.Hour))
+	diagnosis = diagnoseTestServer(t, server, root.cert, "")
+	assert.Equal(t, []TLSProblemKind{TLSProblemExpired}, problemKinds(diagnosis))
+	assert.Contains(t, diagnosis.String(), "Problem (expired): the certificate CN=kube-apiserver expired")
+
+	// test that plain HTTP servers are rejected
+	_, err := DiagnoseTLS(context.Background(), ConnectionParameters{Host: "http://127.0.0.1:8080"})
+	assert.ErrorContains(t, err, "does not use TLS")
+}
@@ -0,0 +1,79 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// tlsTransportOptions customizes the TLS settings of the transport client-go builds for a connection, beyond what the
+// rest config supports.
+type tlsTransportOptions struct {
+	// verifyConnection runs after the certificate verification of client-go, for example to enforce pinned public
+	// keys.
+	verifyConnection func(tls.ConnectionState) error
+	// getClientCertificate serves the client certificate in place of client-go.
+	getClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+	// onTransport is called with every transport the wrapper builds.
+	onTransport func(*http.Transport)
+}
+
+func (o tlsTransportOptions) empty() bool {
+	return o.verifyConnection == nil && o.getClientCertificate == nil && o.onTransport == nil
+}
+
+// newTLSTransportWrapper returns a transport wrapper that applies the options. It must wrap the http.Transport
+// client-go builds, so it has to be the first wrapper. The transport is rebuilt with the same settings rather than
+// modified, as client-go shares it between clients with the same TLS settings, and its HTTP/2 connection pool must not
+// hand out connections made without the options.
+func newTLSTransportWrapper(opts tlsTransportOptions) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		base, ok := rt.(*http.Transport)
+		if !ok {
+			return errorRoundTripper{err: fmt.Errorf("cannot customize the TLS settings of a %T transport", rt)}
+		}
+		tlsConfig := base.TLSClientConfig.Clone()
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if opts.verifyConnection != nil {
+			if verifyConnection := tlsConfig.VerifyConnection; verifyConnection != nil {
+				tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+					if err := verifyConnection(state); err != nil {
+						return err
+					}
+					return opts.verifyConnection(state)
+				}
+			} else {
+				tlsConfig.VerifyConnection = opts.verifyConnection
+			}
+		}
+		if opts.getClientCertificate != nil {
+			tlsConfig.Certificates = nil
+			tlsConfig.GetClientCertificate = opts.getClientCertificate
+		}
+		transport := utilnet.SetTransportDefaults(&http.Transport{
+			Proxy:               base.Proxy,
+			TLSHandshakeTimeout: base.TLSHandshakeTimeout,
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConnsPerHost: base.MaxIdleConnsPerHost,
+			DialContext:         base.DialContext,
+			DisableCompression:  base.DisableCompression,
+		})
+		if opts.onTransport != nil {
+			opts.onTransport(transport)
+		}
+		return transport
+	}
+}
+
+// errorRoundTripper fails all requests, so a transport the TLS options cannot be applied to is never used.
+type errorRoundTripper struct {
+	err error
+}
+
+func (e errorRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, e.err
+}
@@ -0,0 +1,84 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultBearerTokenFile is the projected service account token Kubernetes mounts into a pod. It is the default of
+// the bearerTokenFile connection property.
+const DefaultBearerTokenFile = DefaultServiceAccountDir + "/token"
+
+// connectionBearerTokenFile returns the token file the connection authenticates with, or an empty string if the
+// token file is not used. The default token file is skipped when it does not exist, so connections with the schema
+// defaults work outside a pod. Any other credentials take precedence over the token file, as client-go would otherwise
+// send the token from the file in place of an explicit bearer token, and a connection set up with its own credentials
+// inside a pod would authenticate with the service account of the pod.
+func connectionBearerTokenFile(connection ConnectionParameters) string {
+	if connection.BearerTokenFile == "" || connection.Username != "" || connection.Exec != nil || connection.OIDC != nil ||
+		connection.BearerToken != "" || connection.CertData != "" || connection.CertFile != "" {
+		return ""
+	}
+	if isMissingDefaultBearerTokenFile(connection.BearerTokenFile) {
+		return ""
+	}
+	return connection.BearerTokenFile
+}
+
+// isMissingDefaultBearerTokenFile returns true if the token file is the default token file and the process does not
+// run inside a pod, so the file does not exist.
+func isMissingDefaultBearerTokenFile(tokenFile string) bool {
+	if tokenFile != DefaultBearerTokenFile {
+		return false
+	}
+	_, err := os.Stat(tokenFile)
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// tokenFileRefreshRoundTripper re-reads the bearer token file when the API server rejects a request with 401
+// Unauthorized. Client-go only reloads the token file once a minute, while a projected token may have been rotated in
+// the meantime. If the file holds a different token than the rejected one, the request is retried once with it.
+type tokenFileRefreshRoundTripper struct {
+	tokenFile string
+	rt        http.RoundTripper
+}
+
+func newTokenFileRefreshRoundTripper(tokenFile string) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &tokenFileRefreshRoundTripper{tokenFile: tokenFile, rt: rt}
+	}
+}
+
+func (t *tokenFileRefreshRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	tokenData, err := os.ReadFile(t.tokenFile)
+	if err != nil {
+		return resp, nil
+	}
+	token := strings.TrimSpace(string(tokenData))
+	if token == "" || req.Header.Get("Authorization") == "Bearer "+token {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return t.rt.RoundTrip(retry)
+}
@@ -0,0 +1,128 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTokenServer(t *testing.T, token string) (*httptest.Server, func(token string), *int) {
+	var lock sync.Mutex
+	rejected := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			rejected++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "33", "gitVersion": "v1.33.2"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func(newToken string) {
+		lock.Lock()
+		defer lock.Unlock()
+		token = newToken
+	}, &rejected
+}
+
+func TestConnectionToRestConfigTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("first-token\n"), 0600))
+	server, rotate, rejected := newTokenServer(t, "first-token")
+
+	connection := ConnectionParameters{
+		Host:            strings.TrimPrefix(server.URL, "http://"),
+		BearerTokenFile: tokenFile,
+	}
+	config, err := ConnectionToRestConfig(connection)
+	assert.Nil(t, err)
+	assert.Equal(t, tokenFile, config.BearerTokenFile)
+
+	client, err := Client(connection)
+	assert.Nil(t, err)
+	version, err := client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.33.2", version.GitVersion)
+
+	// test that a token rotated mid-run is picked up after the server rejects the old one
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("second-token\n"), 0600))
+	rotate("second-token")
+	for i := 0; i < 3; i++ {
+		version, err = client.Discovery().ServerVersion()
+		assert.Nil(t, err)
+		assert.Equal(t, "v1.33.2", version.GitVersion)
+	}
+	assert.Equal(t, 3, *rejected)
+
+	// test that a rejected request is retried only once with the token from the file
+	rotate("third-token")
+	_, err = client.Discovery().ServerVersion()
+	assert.NotNil(t, err)
+	assert.Equal(t, 5, *rejected)
+}
+
+func TestConnectionBearerTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("token"), 0600))
+
+	assert.Equal(t, tokenFile, connectionBearerTokenFile(ConnectionParameters{BearerTokenFile: tokenFile}))
+	assert.Empty(t, connectionBearerTokenFile(ConnectionParameters{
+		BearerTokenFile: tokenFile,
+		Username:        "testuser",
+		Password:        "testpassword",
+	}))
+	assert.Empty(t, connectionBearerTokenFile(ConnectionParameters{
+		BearerTokenFile: tokenFile,
+		Exec:            &ExecConfig{Command: "plugin"},
+	}))
+	assert.Empty(t, connectionBearerTokenFile(ConnectionParameters{
+		BearerTokenFile: tokenFile,
+		BearerToken:     "token",
+	}))
+	assert.Empty(t, connectionBearerTokenFile(ConnectionParameters{
+		BearerTokenFile: tokenFile,
+		CertFile:        "client.crt",
+		KeyFile:         "client.key",
+	}))
+	if _, err := os.Stat(DefaultBearerTokenFile); err != nil {
+		assert.Empty(t, connectionBearerTokenFile(ConnectionParameters{BearerTokenFile: DefaultBearerTokenFile}))
+	}
+}
+
+func TestConnectionToRestConfigExplicitToken(t *testing.T) {
+	// The token file stands in for the default service account token, which is readable inside a pod.
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("pod-token\n"), 0600))
+	server, _, rejected := newTokenServer(t, "explicit-token")
+
+	var connection ConnectionParameters
+	assert.Nil(t, json.Unmarshal([]byte(`{"host": "`+server.URL+`", "bearerToken": "explicit-token"}`), &connection))
+	assert.Equal(t, DefaultBearerTokenFile, connection.BearerTokenFile)
+	connection.BearerTokenFile = tokenFile
+	connection.CAFile = ""
+
+	// test that the explicit token is sent rather than the token from the file
+	config, err := ConnectionToRestConfig(connection)
+	assert.Nil(t, err)
+	assert.Empty(t, config.BearerTokenFile)
+	client, err := Client(connection)
+	assert.Nil(t, err)
+	_, err = client.Discovery().ServerVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, *rejected)
+
+	// test that the kubeconfig does not reference the unused token file
+	kubeconfig, err := ConnectionToKubeConfig(connection)
+	assert.Nil(t, err)
+	assert.Nil(t, kubeconfig.Users[0].User.TokenFile)
+	assert.Equal(t, "explicit-token", *kubeconfig.Users[0].User.Token)
+}
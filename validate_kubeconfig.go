@@ -0,0 +1,198 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// DiagnosticSeverity is the severity of a problem found by ValidateKubeConfig.
+type DiagnosticSeverity string
+
+const (
+	// DiagnosticSeverityError marks a problem that makes the affected entry unusable.
+	DiagnosticSeverityError DiagnosticSeverity = "error"
+	// DiagnosticSeverityWarning marks a problem that kubectl and this library tolerate, but that is likely a mistake.
+	DiagnosticSeverityWarning DiagnosticSeverity = "warning"
+)
+
+// Diagnostic is a single problem found in a kubeconfig. The path points to the offending field, for example
+// users[2].user.client-key-data. The origin is the file the offending entry was loaded from, so problems in a
+// kubeconfig merged from several files can be traced back to their file. It is empty if the kubeconfig was not loaded
+// from a file.
+type Diagnostic struct {
+	Severity DiagnosticSeverity `json:"severity"`
+	Origin   string             `json:"origin"`
+	Path     string             `json:"path"`
+	Message  string             `json:"message"`
+}
+
+// String returns the diagnostic as a single line in the form severity: origin: path: message. The origin is left out
+// if it is empty.
+func (d Diagnostic) String() string {
+	if d.Origin == "" {
+		return fmt.Sprintf("%s: %s: %s", d.Severity, d.Path, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", d.Severity, d.Origin, d.Path, d.Message)
+}
+
+// ValidateKubeConfig checks the kubeconfig for problems that would otherwise only surface one at a time when a context
+// is converted: duplicate names, dangling references, missing servers, conflicting file and data fields, undecodable
+// base64 data, unreadable files and malformed PEM data. Files are resolved the same way as in
+// KubeConfigToConnectionForContext. An empty result means no problems were found.
+func ValidateKubeConfig(kubeconfig KubeConfig) []Diagnostic {
+	v := &kubeConfigValidator{}
+
+	clusterNames := map[string]bool{}
+	for i, cluster := range kubeconfig.Clusters {
+		path := fmt.Sprintf("clusters[%d]", i)
+		v.origin = entryOrigin(cluster.Origin, kubeconfig)
+		v.checkName(clusterNames, path, "cluster", cluster.Name)
+		v.checkCluster(path+".cluster", cluster.Cluster, v.origin)
+	}
+
+	userNames := map[string]bool{}
+	for i, user := range kubeconfig.Users {
+		path := fmt.Sprintf("users[%d]", i)
+		v.origin = entryOrigin(user.Origin, kubeconfig)
+		v.checkName(userNames, path, "user", user.Name)
+		v.checkUser(path+".user", user.User, v.origin)
+	}
+
+	contextNames := map[string]bool{}
+	for i, context := range kubeconfig.Contexts {
+		path := fmt.Sprintf("contexts[%d]", i)
+		v.origin = entryOrigin(context.Origin, kubeconfig)
+		v.checkName(contextNames, path, "context", context.Name)
+		if !clusterNames[context.Context.Cluster] {
+			v.errorf(path+".context.cluster", "%s", (&ClusterNotFoundError{Name: context.Context.Cluster}).Error())
+		}
+		if !userNames[context.Context.User] {
+			v.errorf(path+".context.user", "%s", (&UserNotFoundError{Name: context.Context.User}).Error())
+		}
+	}
+
+	v.origin = kubeconfig.Origin
+	if kubeconfig.CurrentContext != nil && !contextNames[*kubeconfig.CurrentContext] {
+		v.errorf("current-context", "%s", (&ContextNotFoundError{Name: *kubeconfig.CurrentContext}).Error())
+	}
+	return v.diagnostics
+}
+
+// entryOrigin returns the file a kubeconfig entry was loaded from. Entries without an origin of their own come from
+// the file of the kubeconfig.
+func entryOrigin(origin string, kubeconfig KubeConfig) string {
+	if origin == "" {
+		return kubeconfig.Origin
+	}
+	return origin
+}
+
+type kubeConfigValidator struct {
+	diagnostics []Diagnostic
+	// origin is the file of the entry being checked.
+	origin string
+}
+
+func (v *kubeConfigValidator) errorf(path string, format string, args ...any) {
+	v.report(DiagnosticSeverityError, path, fmt.Sprintf(format, args...))
+}
+
+func (v *kubeConfigValidator) warnf(path string, format string, args ...any) {
+	v.report(DiagnosticSeverityWarning, path, fmt.Sprintf(format, args...))
+}
+
+func (v *kubeConfigValidator) report(severity DiagnosticSeverity, path string, message string) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity: severity,
+		Origin:   v.origin,
+		Path:     path,
+		Message:  message,
+	})
+}
+
+// checkName reports duplicate names. As in kubectl, the first entry with a name is used and later ones are ignored.
+func (v *kubeConfigValidator) checkName(seen map[string]bool, path string, kind string, name string) {
+	if seen[name] {
+		v.warnf(path+".name", "duplicate %s name %s, only the first %s with this name is used", kind, name, kind)
+	}
+	seen[name] = true
+}
+
+func (v *kubeConfigValidator) checkCluster(path string, cluster KubeConfigClusterParams, origin string) {
+	if cluster.Server == "" {
+		v.errorf(path+".server", "no server set")
+	} else if _, err := serverToHost(cluster.Server); err != nil {
+		v.errorf(path+".server", "%s", err.Error())
+	}
+	v.checkFileAndData(
+		path, "certificate-authority", cluster.CertificateAuthority, cluster.CertificateAuthorityData, origin,
+		validateCertificatesPEM,
+	)
+}
+
+func (v *kubeConfigValidator) checkUser(path string, user KubeConfigUserParameters, origin string) {
+	v.checkFileAndData(
+		path, "client-certificate", user.ClientCertificate, user.ClientCertificateData, origin,
+		validateCertificatesPEM,
+	)
+	v.checkFileAndData(path, "client-key", user.ClientKey, user.ClientKeyData, origin, validatePrivateKeyPEM)
+	hasCert := user.ClientCertificate != nil || user.ClientCertificateData != nil
+	hasKey := user.ClientKey != nil || user.ClientKeyData != nil
+	if hasCert && !hasKey {
+		v.errorf(path+".client-key", "client certificate set without a client key")
+	}
+	if hasKey && !hasCert {
+		v.errorf(path+".client-certificate", "client key set without a client certificate")
+	}
+	if user.TokenFile != nil {
+		v.checkFile(path+".tokenFile", *user.TokenFile, origin, nil)
+	}
+}
+
+// checkFileAndData checks a pair of fields like client-key and client-key-data, which hold the same value either in a
+// file or base64 encoded inline.
+func (v *kubeConfigValidator) checkFileAndData(
+	path string,
+	field string,
+	file *string,
+	data *string,
+	origin string,
+	checkPEM func([]byte) error,
+) {
+	if file != nil && data != nil {
+		v.warnf(path+"."+field, "both %s and %s-data are set, %s-data takes precedence", field, field, field)
+	}
+	if file != nil {
+		v.checkFile(path+"."+field, *file, origin, checkPEM)
+	}
+	if data != nil {
+		decoded, err := base64.StdEncoding.DecodeString(*data)
+		if err != nil {
+			v.errorf(path+"."+field+"-data", "invalid base64 data (%s)", err.Error())
+			return
+		}
+		if err := checkPEM(decoded); err != nil {
+			v.errorf(path+"."+field+"-data", "%s", err.Error())
+		}
+	}
+}
+
+func (v *kubeConfigValidator) checkFile(path string, file string, origin string, checkPEM func([]byte) error) {
+	resolved, err := resolveKubeConfigPath(file, origin)
+	if err != nil {
+		v.errorf(path, "%s", err.Error())
+		return
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		v.errorf(path, "%s", (&CredentialFileError{Path: resolved, Err: err}).Error())
+		return
+	}
+	if checkPEM == nil {
+		return
+	}
+	if err := checkPEM(data); err != nil {
+		v.errorf(path, "%s in %s", err.Error(), resolved)
+	}
+}
@@ -0,0 +1,112 @@
+package arcaflow_lib_kubernetes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateKubeConfig(t *testing.T) {
+	fixtures := NewFixtures(t)
+	for _, data := range []string{fixtures.kubeconfig, fixtures.kubeconfigNoData} {
+		kubeconf, err := ParseKubeConfig(data)
+		assert.Nil(t, err)
+		assert.Empty(t, ValidateKubeConfig(kubeconf))
+	}
+
+	caFile := CACERTPATH
+	keyFile := KEYPATH
+	missingFile := "testdata/missing.crt"
+	caData := base64.StdEncoding.EncodeToString([]byte(fixtures.caCert))
+	notPEM := base64.StdEncoding.EncodeToString([]byte("not a certificate"))
+	notBase64 := "not base64!"
+	currentContext := "missing"
+	kubeconf := KubeConfig{
+		Clusters: []KubeConfigCluster{
+			{Name: "dev", Cluster: KubeConfigClusterParams{
+				Server:                   "https://127.0.0.1:6443",
+				CertificateAuthority:     &caFile,
+				CertificateAuthorityData: &caData,
+			}},
+			{Name: "dev", Cluster: KubeConfigClusterParams{Server: "ftp://127.0.0.1"}},
+			{Name: "prod", Cluster: KubeConfigClusterParams{CertificateAuthority: &keyFile}},
+		},
+		Contexts: []KubeConfigContext{
+			{Name: "dev", Context: KubeConfigContextParameters{Cluster: "dev", User: "developer"}},
+			{Name: "prod", Context: KubeConfigContextParameters{Cluster: "staging", User: "operator"}},
+		},
+		Users: []KubeConfigUser{
+			{Name: "developer", User: KubeConfigUserParameters{ClientCertificate: &missingFile, ClientKey: &keyFile}},
+			{Name: "tester", User: KubeConfigUserParameters{ClientCertificateData: &notPEM}},
+			{Name: "admin", User: KubeConfigUserParameters{
+				ClientCertificateData: &caData,
+				ClientKeyData:         &notBase64,
+			}},
+		},
+		CurrentContext: &currentContext,
+	}
+
+	diagnostics := ValidateKubeConfig(kubeconf)
+	paths := map[string]DiagnosticSeverity{}
+	for _, diagnostic := range diagnostics {
+		paths[diagnostic.Path] = diagnostic.Severity
+	}
+	assert.Equal(t, map[string]DiagnosticSeverity{
+		"clusters[0].cluster.certificate-authority": DiagnosticSeverityWarning,
+		"clusters[1].name":                          DiagnosticSeverityWarning,
+		"clusters[1].cluster.server":                DiagnosticSeverityError,
+		"clusters[2].cluster.server":                DiagnosticSeverityError,
+		"clusters[2].cluster.certificate-authority": DiagnosticSeverityError,
+		"users[0].user.client-certificate":          DiagnosticSeverityError,
+		"users[1].user.client-certificate-data":     DiagnosticSeverityError,
+		"users[1].user.client-key":                  DiagnosticSeverityError,
+		"users[2].user.client-key-data":             DiagnosticSeverityError,
+		"contexts[1].context.cluster":               DiagnosticSeverityError,
+		"contexts[1].context.user":                  DiagnosticSeverityError,
+		"current-context":                           DiagnosticSeverityError,
+	}, paths)
+	assert.Len(t, diagnostics, len(paths))
+
+	// test that files are resolved relative to the kubeconfig they were loaded from
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(dir+"/ca.crt", []byte(fixtures.caCert), 0600))
+	relativeFile := "ca.crt"
+	kubeconf = KubeConfig{
+		Clusters: []KubeConfigCluster{{Name: "dev", Cluster: KubeConfigClusterParams{
+			Server:               "https://127.0.0.1:6443",
+			CertificateAuthority: &relativeFile,
+		}}},
+		Origin: dir + "/config",
+	}
+	assert.Empty(t, ValidateKubeConfig(kubeconf))
+}
+
+func TestValidateKubeConfigOrigin(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	broken := filepath.Join(dir, "broken.yaml")
+	assert.Nil(t, os.WriteFile(valid, []byte(firstKubeConfig), 0600))
+	assert.Nil(t, os.WriteFile(broken, []byte(`apiVersion: v1
+kind: Config
+users:
+  - name: broken
+    user:
+      tokenFile: missing-token
+`), 0600))
+	kubeconf, err := LoadKubeConfigFiles(valid, broken)
+	assert.Nil(t, err)
+
+	// test that the diagnostic names the file the broken entry was loaded from
+	diagnostics := ValidateKubeConfig(kubeconf)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, broken, diagnostics[0].Origin)
+	assert.Equal(t, "users[1].user.tokenFile", diagnostics[0].Path)
+	assert.True(t, strings.HasPrefix(diagnostics[0].String(), "error: "+broken+": users[1].user.tokenFile: "))
+	data, err := json.Marshal(diagnostics[0])
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"origin":`)
+}